@@ -0,0 +1,75 @@
+package bytecodec
+
+import "testing"
+
+type benchHeader struct {
+	MsgID    uint16
+	Props    uint16
+	Phone    string `bytecodec:"bcd8421:6,true"`
+	SerialNo uint16
+}
+
+type benchPacket struct {
+	Header    benchHeader
+	Flags     uint8
+	Lat       uint32
+	Lon       uint32
+	Speed     uint16 `bytecodec:"le"`
+	MsgLength uint8  `bytecodec:"lengthref:Msg"`
+	Msg       string `bytecodec:"gbk"`
+	Count     uint16 `bytecodec:"lengthref:Items"`
+	Items     []uint32
+	Check     uint8 `bytecodec:"checksum:xor"`
+}
+
+type benchFlat struct {
+	A, B, C, D uint32
+	E, F       uint16
+	G          uint64
+	H          int8
+}
+
+var benchPacketValue = benchPacket{
+	Header: benchHeader{MsgID: 0x0200, Props: 0x0010, Phone: "18102169375", SerialNo: 1},
+	Flags:  1,
+	Lat:    31000000,
+	Lon:    121000000,
+	Speed:  60,
+	Msg:    "你好",
+	Items:  []uint32{1, 2, 3, 4},
+}
+
+func BenchmarkMarshalFlat(b *testing.B) {
+	v := benchFlat{1, 2, 3, 4, 5, 6, 7, 8}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalPacket(b *testing.B) {
+	v := benchPacketValue
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalPacket(b *testing.B) {
+	data, err := Marshal(&benchPacketValue)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v benchPacket
+		if err := Unmarshal(data, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
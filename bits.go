@@ -0,0 +1,140 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// bitWriter 把连续的 bits 字段写入同一个比特流，默认先写字节的高位
+type bitWriter struct {
+	buf []byte
+	n   uint // 已经写入的比特数
+	lsb bool // 先写字节的低位
+}
+
+func (w *bitWriter) write(u uint64, bits int) {
+	for i := 0; i < bits; i++ {
+		var bit uint64
+		if w.lsb {
+			bit = u >> uint(i) & 1
+		} else {
+			bit = u >> uint(bits-1-i) & 1
+		}
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if bit != 0 {
+			if w.lsb {
+				w.buf[len(w.buf)-1] |= 1 << (w.n % 8)
+			} else {
+				w.buf[len(w.buf)-1] |= 0x80 >> (w.n % 8)
+			}
+		}
+		w.n++
+	}
+}
+
+// bitReader 从比特流中读取连续的 bits 字段，需要时才从 CodecState 中读取下一个字节
+type bitReader struct {
+	b   byte
+	n   uint // 当前字节已经读取的比特数
+	lsb bool
+}
+
+func (r *bitReader) read(c *CodecState, bits int) uint64 {
+	var u uint64
+	for i := 0; i < bits; i++ {
+		if r.n%8 == 0 {
+			r.b = c.ReadByte()
+			r.n = 0
+		}
+		var bit uint64
+		if r.lsb {
+			bit = uint64(r.b >> r.n & 1)
+		} else {
+			bit = uint64(r.b << r.n >> 7)
+		}
+		r.n++
+		if r.lsb {
+			u |= bit << uint(i)
+		} else {
+			u = u<<1 | bit
+		}
+	}
+	return u
+}
+
+// bitRun 是结构体中一组连续的 bits 字段，比特流结束时写入 CodecState
+type bitRun struct {
+	w *bitWriter
+}
+
+func checkBits(c *CodecState, f field, fv reflect.Value) {
+	switch fv.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		c.error(&TagErr{fmt.Errorf("bits %s type %q is invalid", f.name, fv.Kind())})
+	}
+	if f.tagOptions.bits > 64 || (fv.Kind() != reflect.Bool && f.tagOptions.bits > fv.Type().Bits()) {
+		c.error(&TagErr{fmt.Errorf("bits %s %d bits is too wide for type %q", f.name, f.tagOptions.bits, fv.Kind())})
+	}
+}
+
+func (run *bitRun) encode(c *CodecState, f field, fv reflect.Value) {
+	checkBits(c, f, fv)
+	if run.w == nil {
+		run.w = &bitWriter{lsb: f.tagOptions.bitsLSB}
+	}
+
+	bits := f.tagOptions.bits
+	var u uint64
+	switch fv.Kind() {
+	case reflect.Bool:
+		if fv.Bool() {
+			u = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := fv.Int()
+		if !f.tagOptions.wrap && overflowsInt(n, bits, true) {
+			c.error(&OverflowError{Field: f.name, Width: bits, Value: n})
+		}
+		u = uint64(n)
+	default:
+		u = fv.Uint()
+		if !f.tagOptions.wrap && overflowsUint(u, bits) {
+			c.error(&OverflowError{Field: f.name, Width: bits, Value: u})
+		}
+	}
+	run.w.write(u, bits)
+}
+
+// flush 结束当前的比特流，最后一个字节中没有使用的比特填充为 0
+func (run *bitRun) flush(c *CodecState) {
+	if run.w == nil {
+		return
+	}
+	c.Write(run.w.buf)
+	run.w = nil
+}
+
+func decodeBits(c *CodecState, frame *decodeFrame, f field, fv reflect.Value) {
+	checkBits(c, f, fv)
+	if frame.bits == nil {
+		frame.bits = &bitReader{lsb: f.tagOptions.bitsLSB}
+	}
+
+	bits := f.tagOptions.bits
+	u := frame.bits.read(c, bits)
+	switch fv.Kind() {
+	case reflect.Bool:
+		fv.SetBool(u != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// 符号扩展
+		shift := uint(64 - bits)
+		fv.SetInt(int64(u<<shift) >> shift)
+	default:
+		fv.SetUint(u)
+	}
+}
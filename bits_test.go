@@ -0,0 +1,107 @@
+package bytecodec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type bitsMSB struct {
+	A uint8  `bytecodec:"bits:3"`
+	B bool   `bytecodec:"bits:1"`
+	C uint16 `bytecodec:"bits:12"`
+	D uint8
+	E int8 `bytecodec:"bits:3"`
+}
+
+type bitsLSB struct {
+	A uint8 `bytecodec:"bits:4,lsb"`
+	B int8  `bytecodec:"bits:4"`
+	C uint16
+}
+
+type bitsLengthref struct {
+	Flags uint8 `bytecodec:"bits:4"`
+	Count uint8 `bytecodec:"bits:4;lengthref:Items"`
+	Items []uint16
+}
+
+var bitsTests = []testcase{{
+	[]byte{
+		0xba, 0xbc,
+		0x7,
+		0xa0,
+	},
+	&bitsMSB{},
+	&bitsMSB{A: 5, B: true, C: 0xabc, D: 7, E: -3},
+}, {
+	[]byte{
+		0xe3,
+		0x0, 0x1,
+	},
+	&bitsLSB{},
+	&bitsLSB{A: 3, B: -2, C: 1},
+}, {
+	[]byte{
+		0x12,
+		0x0, 0x1, 0x0, 0x2,
+	},
+	&bitsLengthref{},
+	&bitsLengthref{Flags: 1, Count: 2, Items: []uint16{1, 2}},
+}}
+
+func TestBits(t *testing.T) {
+	testMarshalUnmarshal(t, bitsTests)
+}
+
+func TestBitsOverflow(t *testing.T) {
+	values := []interface{}{
+		&bitsMSB{A: 8},
+		&bitsMSB{E: 4},
+		&bitsMSB{E: -5},
+	}
+	for _, v := range values {
+		var oe *OverflowError
+		if _, err := Marshal(v); !errors.As(err, &oe) || oe.Width != 3 {
+			t.Errorf("Marshal %#v got error %v, want OverflowError", v, err)
+		}
+	}
+
+	// wrap 标签只保留低位
+	b, err := Marshal(struct {
+		A uint8 `bytecodec:"bits:4;wrap"`
+		B int8  `bytecodec:"bits:4;wrap"`
+	}{0x1f, -9})
+	if want := []byte{0xf7}; err != nil || !reflect.DeepEqual(b, want) {
+		t.Errorf("Marshal wrap = %#v, %v, want %#v", b, err, want)
+	}
+}
+
+func TestBitsTagErr(t *testing.T) {
+	values := []interface{}{
+		&struct {
+			A uint8 `bytecodec:"bits:0"`
+		}{},
+		&struct {
+			A uint8 `bytecodec:"bits:abc"`
+		}{},
+		&struct {
+			A uint8 `bytecodec:"bits:4,lbs"`
+		}{},
+		&struct {
+			A uint8 `bytecodec:"bits:9"`
+		}{},
+		&struct {
+			A uint64 `bytecodec:"bits:65"`
+		}{},
+	}
+	for _, v := range values {
+		var te *TagErr
+		if _, err := Marshal(v); !errors.As(err, &te) {
+			t.Errorf("Marshal %#v got error %v, want TagErr", v, err)
+		}
+		if err := Unmarshal([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, v); !errors.As(err, &te) {
+			t.Errorf("Unmarshal %#v got error %v, want TagErr", v, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package bytecodec
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sync"
+)
+
+// A ChecksumError is returned by Unmarshal when the checksum field does not
+// match the checksum computed over the received bytes.
+type ChecksumError struct {
+	Field     string
+	Algorithm string
+	Expected  uint64 // 根据收到的数据计算出的校验值
+	Actual    uint64 // 校验字段中的值
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("bytecodec: %s checksum mismatch for field %s: expected %#x, actual %#x", e.Algorithm, e.Field, e.Expected, e.Actual)
+}
+
+// ChecksumFunc 计算 data 的校验值
+type ChecksumFunc func(data []byte) uint64
+
+type checksumAlgo struct {
+	bits int // 校验值的位数，校验字段的类型不能比它更窄
+	sum  ChecksumFunc
+}
+
+var checksumAlgos sync.Map // map[string]checksumAlgo
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RegisterChecksum 注册自定义的校验算法，之后可以在 checksum 标签中通过 name 使用
+// bits 是校验值的位数，同名的算法会被覆盖
+func RegisterChecksum(name string, bits int, sum ChecksumFunc) {
+	checksumAlgos.Store(name, checksumAlgo{bits, sum})
+}
+
+func init() {
+	RegisterChecksum("xor", 8, checksumXOR)
+	RegisterChecksum("sum8", 8, checksumSum8)
+	RegisterChecksum("crc8", 8, checksumCRC8)
+	RegisterChecksum("crc16-modbus", 16, checksumCRC16Modbus)
+	RegisterChecksum("crc16-ccitt", 16, func(data []byte) uint64 { return crc16CCITT(0xffff, data) })
+	RegisterChecksum("crc16-xmodem", 16, func(data []byte) uint64 { return crc16CCITT(0, data) })
+	RegisterChecksum("crc32", 32, func(data []byte) uint64 { return uint64(crc32.ChecksumIEEE(data)) })
+	RegisterChecksum("crc32c", 32, func(data []byte) uint64 { return uint64(crc32.Checksum(data, castagnoliTable)) })
+}
+
+func checksumXOR(data []byte) uint64 {
+	var x byte
+	for _, b := range data {
+		x ^= b
+	}
+	return uint64(x)
+}
+
+func checksumSum8(data []byte) uint64 {
+	var s byte
+	for _, b := range data {
+		s += b
+	}
+	return uint64(s)
+}
+
+// checksumCRC8 CRC-8/SMBUS，多项式 0x07，初始值 0
+func checksumCRC8(data []byte) uint64 {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// checksumCRC16Modbus CRC-16/MODBUS，Modbus RTU 中低字节在前，字段需要使用 le 标签
+func checksumCRC16Modbus(data []byte) uint64 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// crc16CCITT 多项式 0x1021，初始值 0xffff 时为 CRC-16/CCITT-FALSE，初始值 0 时为 CRC-16/XMODEM
+func crc16CCITT(crc uint16, data []byte) uint64 {
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint64(crc)
+}
+
+// checksumRange 是一个校验字段和它覆盖的字段范围，都是字段在 structFields.list 中的下标
+type checksumRange struct {
+	index    int
+	from, to int
+	algo     checksumAlgo
+}
+
+// checksumRanges 解析结构体中所有的校验字段
+// 没有指定 from 时从第一个字段开始，没有指定 to 时到校验字段的前一个字段结束
+func (sc structCoder) checksumRanges(c *CodecState) []checksumRange {
+	var ranges []checksumRange
+	for i, f := range sc.fields.list {
+		if f.tagOptions.checksum == "" {
+			continue
+		}
+		algo, ok := checksumAlgos.Load(f.tagOptions.checksum)
+		if !ok {
+			c.error(&TagErr{fmt.Errorf("checksum %s unknown algorithm %s", f.name, f.tagOptions.checksum)})
+		}
+
+		cr := checksumRange{index: i, from: 0, to: i - 1, algo: algo.(checksumAlgo)}
+		if f.tagOptions.checksumFrom != "" {
+			cr.from = sc.fieldIndex(c, f, f.tagOptions.checksumFrom)
+		}
+		if f.tagOptions.checksumTo != "" {
+			cr.to = sc.fieldIndex(c, f, f.tagOptions.checksumTo)
+		}
+		if cr.from > cr.to || (cr.from <= i && i <= cr.to) {
+			c.error(&TagErr{fmt.Errorf("checksum %s invalid range %d..%d", f.name, cr.from, cr.to)})
+		}
+		ranges = append(ranges, cr)
+	}
+	return ranges
+}
+
+func (sc structCoder) fieldIndex(c *CodecState, f field, name string) int {
+	for i, item := range sc.fields.list {
+		if item.name == name {
+			return i
+		}
+	}
+	c.error(&TagErr{fmt.Errorf("checksum %s not fount field %s", f.name, name)})
+	return -1
+}
+
+// checksumValue 把校验值转换为校验字段的类型
+func (cr checksumRange) checksumValue(c *CodecState, f field, t reflect.Type, sum uint64) reflect.Value {
+	switch t.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+	default:
+		c.error(&TagErr{fmt.Errorf("checksum %s type %q is invalid", f.name, t.Kind())})
+	}
+	if t.Bits() < cr.algo.bits {
+		c.error(&TagErr{fmt.Errorf("checksum %s type %q is too narrow for %s", f.name, t.Kind(), f.tagOptions.checksum)})
+	}
+	v := reflect.New(t).Elem()
+	v.SetUint(sum)
+	return v
+}
+
+// encodeChecksums 在所有字段编码完成后计算校验值，回填到校验字段预留的位置
+// 校验范围内有跨结构体的 lengthref 还在等待回填时，推迟到回填之后再计算，见 resolveHeld
+func (sc structCoder) encodeChecksums(e *structEncoder) {
+	c := e.c
+	for _, cr := range sc.checksumRanges(c) {
+		if !c.waitingIn(e.pos[cr.from], e.pos[cr.to+1]) {
+			e.encodeChecksum(cr)
+			continue
+		}
+		f := sc.fields.list[cr.index]
+		if _, ok := fixedWidth(f); !ok {
+			c.error(&TagErr{fmt.Errorf("checksum %s must have a fixed width when its range has a lengthref to a following field", f.name)})
+		}
+		cr.checksumValue(c, f, e.v.Field(f.index).Type(), 0)
+		e.deferred = append(e.deferred, cr)
+	}
+}
+
+func (e *structEncoder) encodeChecksum(cr checksumRange) {
+	c := e.c
+	f := e.sc.fields.list[cr.index]
+	sum := cr.algo.sum(c.Bytes()[e.pos[cr.from]:e.pos[cr.to+1]])
+	sumv := cr.checksumValue(c, f, e.v.Field(f.index).Type(), sum)
+	e.patch(cr.index, func() { f.codec.encode(c, sumv, f.tagOptions) })
+}
+
+// verifyChecksums 在所有字段解码完成后，使用记录下的字节校验
+func (sc structCoder) verifyChecksums(c *CodecState, v reflect.Value, ranges []checksumRange, recs []*bytes.Buffer) {
+	for i, cr := range ranges {
+		f := sc.fields.list[cr.index]
+		fv := v.Field(f.index)
+		sum := cr.checksumValue(c, f, fv.Type(), cr.algo.sum(recs[i].Bytes())).Uint()
+		if sum != fv.Uint() {
+			c.error(&ChecksumError{Field: f.name, Algorithm: f.tagOptions.checksum, Expected: sum, Actual: fv.Uint()})
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package bytecodec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChecksumAlgorithms(t *testing.T) {
+	data := []byte("123456789")
+	tests := []struct {
+		name string
+		want uint64
+	}{
+		{"xor", 0x31},
+		{"sum8", 0xdd},
+		{"crc8", 0xf4},
+		{"crc16-modbus", 0x4b37},
+		{"crc16-ccitt", 0x29b1},
+		{"crc16-xmodem", 0x31c3},
+		{"crc32", 0xcbf43926},
+		{"crc32c", 0xe3069283},
+	}
+	for _, tt := range tests {
+		algo, ok := checksumAlgos.Load(tt.name)
+		if !ok {
+			t.Errorf("checksum %s not registered", tt.name)
+			continue
+		}
+		if got := algo.(checksumAlgo).sum(data); got != tt.want {
+			t.Errorf("checksum %s = %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+type modbusFrame struct {
+	ID     uint8
+	Length uint8 `bytecodec:"lengthref:Body"`
+	Body   []byte
+	CRC    uint16 `bytecodec:"checksum:crc16-modbus;le"`
+}
+
+type checksumHeader struct {
+	ID   uint8
+	Type uint8
+}
+
+type rangeChecksum struct {
+	Start  uint8
+	Header checksumHeader
+	Body   string `bytecodec:"length:2"`
+	XOR    uint8  `bytecodec:"checksum:xor;from:Header;to:Body"`
+	Sum    uint16 `bytecodec:"checksum:sum8;from:Start"`
+	End    uint8
+}
+
+var checksumTests = []testcase{{
+	[]byte{
+		0x1, 0x3,
+		0x0, 0x0, 0x1,
+		0xd8, 0x44,
+	},
+	&modbusFrame{},
+	&modbusFrame{
+		ID:     1,
+		Length: 3,
+		Body:   []byte{0x0, 0x0, 0x1},
+		CRC:    0x44d8,
+	},
+}, {
+	[]byte{
+		0x7e,
+		0x1, 0x2,
+		0x61, 0x63,
+		0x1,
+		0x0, 0x46,
+		0x7e,
+	},
+	&rangeChecksum{},
+	&rangeChecksum{
+		Start:  0x7e,
+		Header: checksumHeader{ID: 1, Type: 2},
+		Body:   "ac",
+		XOR:    0x1,
+		Sum:    0x46,
+		End:    0x7e,
+	},
+}}
+
+func TestChecksum(t *testing.T) {
+	testMarshalUnmarshal(t, checksumTests)
+}
+
+func TestChecksumError(t *testing.T) {
+	b := []byte{0x1, 0x3, 0x0, 0x0, 0x1, 0xd8, 0x45}
+	err := Unmarshal(b, &modbusFrame{})
+	var ce *ChecksumError
+	if !errors.As(err, &ce) {
+		t.Fatalf("Unmarshal %#v error = %v, want ChecksumError", b, err)
+	}
+	if ce.Field != "CRC" || ce.Expected != 0x44d8 || ce.Actual != 0x45d8 {
+		t.Errorf("Unmarshal %#v error = %#v", b, ce)
+	}
+}
+
+type unknownChecksum struct {
+	Body uint8
+	Sum  uint8 `bytecodec:"checksum:md5"`
+}
+
+func TestUnknownChecksum(t *testing.T) {
+	_, err := Marshal(&unknownChecksum{})
+	if _, ok := err.(*TagErr); !ok {
+		t.Errorf("Marshal unknown checksum error = %v, want TagErr", err)
+	}
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const generatedComment = "// Code generated by bytecodecgen"
+
+type fieldKind int
+
+const (
+	kindBasic  fieldKind = iota // bool 和固定长度的数值
+	kindString                  // string
+	kindSlice                   // 元素为 kindBasic 的 slice
+	kindArray                   // 元素为 kindBasic 的 array
+	kindOther                   // 其他类型交给 CodecState.EncodeField、DecodeField 处理
+)
+
+// basicTypes 是直接生成读写代码的类型和它们的底层类型
+var basicTypes = map[string]string{
+	"bool":    "bool",
+	"int":     "int",
+	"int8":    "int8",
+	"int16":   "int16",
+	"int32":   "int32",
+	"int64":   "int64",
+	"uint":    "uint",
+	"uint8":   "uint8",
+	"uint16":  "uint16",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"uintptr": "uintptr",
+	"float32": "float32",
+	"float64": "float64",
+	"byte":    "uint8",
+	"rune":    "int32",
+	"string":  "string",
+}
+
+type field struct {
+	name      string
+	typ       string // 字段类型的源码
+	tag       string
+	index     int
+	kind      fieldKind
+	basic     string // kindBasic、kindString 为字段的底层类型，kindSlice、kindArray 为元素的底层类型
+	elem      string // kindSlice、kindArray 元素类型的源码
+	order     string // 字段标签指定的字节序
+	length    int
+	lengthref string
+	fallback  bool   // 使用了生成代码不直接处理的标签，例如 varint
+	wrap      bool   // lengthref 的值超出字段的范围时只保留低位
+	ref       *field // lengthref 指向的字段
+	refBy     *field // 通过 lengthref 指向这个字段的字段
+}
+
+func (f *field) parseTag() error {
+	f.length = -1
+	var le, be bool
+	for _, part := range strings.Split(f.tag, ";") {
+		// key.、value. 前缀的标签用于 map，map 字段由反射实现处理
+		if strings.HasPrefix(part, "key.") || strings.HasPrefix(part, "value.") {
+			continue
+		}
+		s := strings.SplitN(part, ":", 2)
+		value := ""
+		if len(s) > 1 {
+			value = s[1]
+		}
+		switch s[0] {
+		case "lengthref":
+			if strings.ContainsAny(value, ",.") {
+				return fmt.Errorf("lengthref %q is not supported", value)
+			}
+			f.lengthref = value
+		case "length":
+			l, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("length expression %q is not supported", value)
+			}
+			f.length = l
+		case "wrap":
+			f.wrap = true
+		case "le":
+			le = true
+		case "be":
+			be = true
+		case "varint", "uvarint", "zigzag", "mqttvarint", "prefix":
+			f.fallback = true
+		case "bits", "checksum", "if", "switch", "sizeref", "countref", "scale", "adjust":
+			return fmt.Errorf("tag %q is not supported", s[0])
+		}
+	}
+	f.order = byteOrderExpr(le, be)
+	return nil
+}
+
+func byteOrderExpr(le, be bool) string {
+	if be {
+		return "binary.BigEndian"
+	}
+	if le {
+		return "binary.LittleEndian"
+	}
+	return ""
+}
+
+type structType struct {
+	name   string
+	order  string // 结构体通过 _ 字段声明的字节序
+	fields []*field
+}
+
+func (s *structType) field(name string) *field {
+	for _, f := range s.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// method 保存一个方法体，生成完成后根据用到的变量生成方法开头的声明
+type method struct {
+	bytes.Buffer
+	order   bool // 使用了结构体的默认字节序
+	scratch bool // 使用了临时缓冲区 b
+}
+
+func (m *method) printf(format string, args ...interface{}) {
+	fmt.Fprintf(m, format, args...)
+}
+
+type generator struct {
+	pkg     string
+	decls   map[string]*ast.TypeSpec
+	coders  map[string]bool // 声明了 MarshalBytes 或 UnmarshalBytes 方法的类型
+	imports map[string]bool
+	tagVars []string // 包级变量的声明
+	buf     bytes.Buffer
+}
+
+func generate(dir string, names []string) ([]byte, error) {
+	g := &generator{
+		decls:   map[string]*ast.TypeSpec{},
+		coders:  map[string]bool{},
+		imports: map[string]bool{},
+	}
+	if err := g.parsePackage(dir); err != nil {
+		return nil, err
+	}
+
+	var structs []*structType
+	for _, name := range names {
+		s, err := g.parseStruct(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		structs = append(structs, s)
+	}
+	for _, s := range structs {
+		g.genMarshal(s)
+		g.genUnmarshal(s)
+	}
+	return g.source(names)
+}
+
+func (g *generator) parsePackage(dir string) error {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		// 跳过之前生成的文件，生成的方法不能影响字段类型的判断
+		if isGenerated(f) {
+			continue
+		}
+		if g.pkg == "" {
+			g.pkg = f.Name.Name
+		}
+		if f.Name.Name != g.pkg {
+			continue
+		}
+
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range d.Specs {
+					ts := spec.(*ast.TypeSpec)
+					g.decls[ts.Name.Name] = ts
+				}
+			case *ast.FuncDecl:
+				if d.Recv == nil || len(d.Recv.List) == 0 {
+					continue
+				}
+				if d.Name.Name == "MarshalBytes" || d.Name.Name == "UnmarshalBytes" {
+					recv := d.Recv.List[0].Type
+					if star, ok := recv.(*ast.StarExpr); ok {
+						recv = star.X
+					}
+					if ident, ok := recv.(*ast.Ident); ok {
+						g.coders[ident.Name] = true
+					}
+				}
+			}
+		}
+	}
+	if g.pkg == "" {
+		return fmt.Errorf("no Go files in %s", dir)
+	}
+	return nil
+}
+
+func isGenerated(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, generatedComment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve 判断类型是否可以直接生成读写代码
+func (g *generator) resolve(expr ast.Expr, depth int) (kind fieldKind, basic, elem string) {
+	if depth > 16 {
+		return kindOther, "", ""
+	}
+	switch t := expr.(type) {
+	case *ast.ParenExpr:
+		return g.resolve(t.X, depth+1)
+	case *ast.Ident:
+		if ts, ok := g.decls[t.Name]; ok {
+			// 自定义 ByteCoder 由它自己的方法处理
+			if g.coders[t.Name] {
+				return kindOther, "", ""
+			}
+			return g.resolve(ts.Type, depth+1)
+		}
+		if b, ok := basicTypes[t.Name]; ok {
+			if b == "string" {
+				return kindString, b, ""
+			}
+			return kindBasic, b, ""
+		}
+	case *ast.ArrayType:
+		ek, eb, _ := g.resolve(t.Elt, depth+1)
+		if ek != kindBasic {
+			return kindOther, "", ""
+		}
+		if t.Len == nil {
+			return kindSlice, eb, types.ExprString(t.Elt)
+		}
+		if _, ok := t.Len.(*ast.Ellipsis); ok {
+			return kindOther, "", ""
+		}
+		return kindArray, eb, types.ExprString(t.Elt)
+	}
+	return kindOther, "", ""
+}
+
+func isNumber(basic string) bool {
+	return basic != "" && basic != "bool" && basic != "string"
+}
+
+func (g *generator) parseStruct(name string) (*structType, error) {
+	ts, ok := g.decls[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in package %s", name, g.pkg)
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not a struct", name)
+	}
+
+	s := &structType{name: name}
+	for _, af := range st.Fields.List {
+		// 和反射实现一样跳过匿名字段
+		if len(af.Names) == 0 {
+			continue
+		}
+		tag := ""
+		if af.Tag != nil {
+			tv, err := strconv.Unquote(af.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(tv).Get("bytecodec")
+		}
+
+		for _, n := range af.Names {
+			if n.Name == "_" {
+				f := &field{tag: tag}
+				if err := f.parseTag(); err != nil {
+					return nil, fmt.Errorf("%s: %v", name, err)
+				}
+				if f.order != "" {
+					s.order = f.order
+				}
+				continue
+			}
+			if !n.IsExported() || tag == "-" {
+				continue
+			}
+
+			f := &field{
+				name:  n.Name,
+				typ:   types.ExprString(af.Type),
+				tag:   tag,
+				index: len(s.fields),
+			}
+			if err := f.parseTag(); err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", name, n.Name, err)
+			}
+			f.kind, f.basic, f.elem = g.resolve(af.Type, 0)
+			s.fields = append(s.fields, f)
+		}
+	}
+
+	for _, f := range s.fields {
+		if f.lengthref == "" {
+			continue
+		}
+		if f.kind != kindBasic || !isNumber(f.basic) {
+			return nil, fmt.Errorf("%s.%s: lengthref field type %s is not a number", name, f.name, f.typ)
+		}
+		ref := s.field(f.lengthref)
+		if ref == nil {
+			return nil, fmt.Errorf("%s.%s: lengthref field %s not found", name, f.name, f.lengthref)
+		}
+		if ref.refBy != nil {
+			return nil, fmt.Errorf("%s.%s: referenced by more than one lengthref", name, ref.name)
+		}
+		f.ref = ref
+		ref.refBy = f
+	}
+	for _, f := range s.fields {
+		// lengthref 指向的其他类型表示字节长度，和使用了 varint 等标签的字段一样交给反射实现
+		if f.fallback || (f.refBy != nil && f.kind != kindString && f.kind != kindSlice) {
+			f.kind = kindOther
+		}
+	}
+	return s, nil
+}
+
+// tagVar 返回保存字段标签的包级变量
+func (g *generator) tagVar(s *structType, f *field) string {
+	name := "bytecodecTag" + s.name + f.name
+	decl := fmt.Sprintf("%s = bytecodec.ParseFieldTag(%q)", name, f.tag)
+	for _, d := range g.tagVars {
+		if d == decl {
+			return name
+		}
+	}
+	g.tagVars = append(g.tagVars, decl)
+	return name
+}
+
+func (g *generator) orderExpr(m *method, f *field) string {
+	if f.order != "" {
+		g.imports["encoding/binary"] = true
+		return f.order
+	}
+	m.order = true
+	return "order"
+}
+
+func (g *generator) header(m *method, s *structType) string {
+	var h bytes.Buffer
+	if s.order != "" {
+		g.imports["encoding/binary"] = true
+		if m.order {
+			fmt.Fprintf(&h, "order := cs.StructByteOrder(%s)\n", s.order)
+		} else {
+			fmt.Fprintf(&h, "cs.StructByteOrder(%s)\n", s.order)
+		}
+	} else if m.order {
+		h.WriteString("order := cs.ByteOrder()\n")
+	}
+	if m.scratch {
+		h.WriteString("var b [8]byte\n")
+	}
+	return h.String()
+}
+
+func (g *generator) genMarshal(s *structType) {
+	m := &method{}
+	for _, f := range s.fields {
+		g.encodeField(m, s, f)
+	}
+	fmt.Fprintf(&g.buf, "// MarshalBytes 实现 bytecodec.ByteCoder\n")
+	fmt.Fprintf(&g.buf, "func (v %s) MarshalBytes(cs *bytecodec.CodecState) error {\n", s.name)
+	g.buf.WriteString(g.header(m, s))
+	g.buf.Write(m.Bytes())
+	g.buf.WriteString("return nil\n}\n\n")
+}
+
+func (g *generator) genUnmarshal(s *structType) {
+	m := &method{}
+	for _, f := range s.fields {
+		g.decodeField(m, s, f)
+	}
+	fmt.Fprintf(&g.buf, "// UnmarshalBytes 实现 bytecodec.ByteCoder\n")
+	fmt.Fprintf(&g.buf, "func (v *%s) UnmarshalBytes(cs *bytecodec.CodecState) error {\n", s.name)
+	g.buf.WriteString(g.header(m, s))
+	g.buf.Write(m.Bytes())
+	g.buf.WriteString("return nil\n}\n\n")
+}
+
+// measure 编码 lengthref 指向的字段，得到它的长度 n<Field>，编码后的字节保存在 b<Field> 中
+func (g *generator) measure(m *method, s *structType, f *field) {
+	switch f.kind {
+	case kindString:
+		m.printf("b%s := cs.StringBytes(%s, %s)\n", f.name, stringExpr(f), g.tagVar(s, f))
+		m.printf("n%s := len(b%s)\n", f.name, f.name)
+	case kindSlice:
+		m.printf("n%s := len(v.%s)\n", f.name, f.name)
+	default:
+		m.printf("b%s, n%s := cs.FieldBytes(v.%s, %s)\n", f.name, f.name, f.name, g.tagVar(s, f))
+	}
+}
+
+func stringExpr(f *field) string {
+	if f.typ == "string" {
+		return "v." + f.name
+	}
+	return "string(v." + f.name + ")"
+}
+
+func (g *generator) encodeField(m *method, s *structType, f *field) {
+	if f.ref != nil {
+		if f.index < f.ref.index {
+			g.measure(m, s, f.ref)
+		}
+		if width, signed := intBits(f.basic); width > 0 && !f.wrap {
+			m.printf("cs.CheckOverflow(%q, int64(n%s), %d, %v)\n", f.name, f.ref.name, width, signed)
+		}
+		if f.kind == kindOther {
+			m.printf("cs.EncodeField(%s(n%s), %s)\n", f.typ, f.ref.name, g.tagVar(s, f))
+		} else {
+			g.encodeBasic(m, "n"+f.ref.name, f.basic, g.orderExpr(m, f))
+		}
+		return
+	}
+	if f.refBy != nil {
+		if f.index < f.refBy.index {
+			g.measure(m, s, f)
+		}
+		if f.kind != kindSlice {
+			m.printf("cs.Write(b%s)\n", f.name)
+			return
+		}
+	}
+
+	switch f.kind {
+	case kindBasic:
+		g.encodeBasic(m, "v."+f.name, f.basic, g.orderExpr(m, f))
+	case kindString:
+		m.printf("cs.Write(cs.StringBytes(%s, %s))\n", stringExpr(f), g.tagVar(s, f))
+	case kindSlice, kindArray:
+		m.printf("for _, e := range v.%s {\n", f.name)
+		g.encodeBasic(m, "e", f.basic, g.orderExpr(m, f))
+		m.printf("}\n")
+		if f.kind == kindSlice && f.length > 0 {
+			m.printf("cs.CheckLength(len(v.%s), %d)\n", f.name, f.length)
+		}
+	default:
+		m.printf("cs.EncodeField(v.%s, %s)\n", f.name, g.tagVar(s, f))
+	}
+}
+
+// intBits 返回长度转换为整数类型 basic 时可能溢出的位数，不会溢出时为 0
+func intBits(basic string) (width int, signed bool) {
+	switch basic {
+	case "int8":
+		return 8, true
+	case "uint8":
+		return 8, false
+	case "int16":
+		return 16, true
+	case "uint16":
+		return 16, false
+	case "int32":
+		return 32, true
+	case "uint32":
+		return 32, false
+	}
+	return 0, false
+}
+
+func (g *generator) encodeBasic(m *method, x, basic, order string) {
+	switch basic {
+	case "bool":
+		m.printf("if %s {\ncs.WriteByte(1)\n} else {\ncs.WriteByte(0)\n}\n", x)
+	case "int8", "uint8":
+		m.printf("cs.WriteByte(byte(%s))\n", x)
+	case "int16", "uint16":
+		m.scratch = true
+		m.printf("%s.PutUint16(b[:2], uint16(%s))\ncs.Write(b[:2])\n", order, x)
+	case "int32", "uint32":
+		m.scratch = true
+		m.printf("%s.PutUint32(b[:4], uint32(%s))\ncs.Write(b[:4])\n", order, x)
+	case "int", "int64", "uint", "uint64", "uintptr":
+		m.scratch = true
+		m.printf("%s.PutUint64(b[:8], uint64(%s))\ncs.Write(b[:8])\n", order, x)
+	case "float32":
+		m.scratch = true
+		g.imports["math"] = true
+		m.printf("cs.CheckFloat(float64(%s), 32)\n", x)
+		m.printf("%s.PutUint32(b[:4], math.Float32bits(float32(%s)))\ncs.Write(b[:4])\n", order, x)
+	case "float64":
+		m.scratch = true
+		g.imports["math"] = true
+		m.printf("cs.CheckFloat(float64(%s), 64)\n", x)
+		m.printf("%s.PutUint64(b[:8], math.Float64bits(float64(%s)))\ncs.Write(b[:8])\n", order, x)
+	}
+}
+
+// lengthArg 返回解码时 lengthref 得到的长度，没有时为 -1
+func lengthArg(f *field) string {
+	if f.refBy != nil && f.refBy.index < f.index {
+		return "n" + f.name
+	}
+	return "-1"
+}
+
+func (g *generator) decodeField(m *method, s *structType, f *field) {
+	switch f.kind {
+	case kindBasic:
+		g.decodeBasic(m, "v."+f.name, f.typ, f.basic, g.orderExpr(m, f))
+	case kindString:
+		if f.typ == "string" {
+			m.printf("cs.DecodeString(&v.%s, %s, %s)\n", f.name, g.tagVar(s, f), lengthArg(f))
+		} else {
+			m.printf("{\ns := string(v.%s)\n", f.name)
+			m.printf("cs.DecodeString(&s, %s, %s)\n", g.tagVar(s, f), lengthArg(f))
+			m.printf("v.%s = %s(s)\n}\n", f.name, f.typ)
+		}
+	case kindSlice:
+		cond := "cs.More()"
+		if n := lengthArg(f); n != "-1" {
+			m.printf("cs.CheckBounded(%s)\n", n)
+			cond = fmt.Sprintf("(%s < 0 || i < %s) && cs.More()", n, n)
+		} else if f.length >= 0 {
+			cond = fmt.Sprintf("i < %d && cs.More()", f.length)
+		} else {
+			m.printf("cs.CheckBounded(-1)\n")
+		}
+		m.printf("{\ni := 0\nfor ; %s; i++ {\n", cond)
+		m.printf("var e %s\n", f.elem)
+		g.decodeBasic(m, "e", f.elem, f.basic, g.orderExpr(m, f))
+		m.printf("if i < len(v.%s) {\nv.%s[i] = e\n} else {\nv.%s = append(v.%s, e)\n}\n}\n", f.name, f.name, f.name, f.name)
+		m.printf("if i == 0 {\nv.%s = %s{}\n}\n}\n", f.name, f.typ)
+	case kindArray:
+		zero := "0"
+		if f.basic == "bool" {
+			zero = "false"
+		}
+		m.printf("{\ni := 0\nfor ; i < len(v.%s) && cs.More(); i++ {\n", f.name)
+		g.decodeBasic(m, "v."+f.name+"[i]", f.elem, f.basic, g.orderExpr(m, f))
+		m.printf("}\nfor ; i < len(v.%s); i++ {\nv.%s[i] = %s\n}\n}\n", f.name, f.name, zero)
+	default:
+		m.printf("cs.DecodeField(&v.%s, %s, %s)\n", f.name, g.tagVar(s, f), lengthArg(f))
+	}
+
+	if f.ref != nil && f.index < f.ref.index {
+		if strings.HasPrefix(f.basic, "uint") {
+			m.printf("n%s := cs.RefLengthUint(%q, uint64(v.%s))\n", f.ref.name, f.name, f.name)
+		} else if strings.HasPrefix(f.basic, "float") {
+			m.printf("n%s := cs.RefLengthFloat(%q, float64(v.%s))\n", f.ref.name, f.name, f.name)
+		} else {
+			m.printf("n%s := cs.RefLength(%q, int64(v.%s))\n", f.ref.name, f.name, f.name)
+		}
+	}
+}
+
+// decodeBasic 解码 basic 类型的值赋给 x，typ 为 x 的类型
+func (g *generator) decodeBasic(m *method, x, typ, basic, order string) {
+	var value, natural string
+	switch basic {
+	case "bool":
+		value, natural = "cs.ReadByte() != 0", "bool"
+	case "int8":
+		value, natural = "int8(cs.ReadByte())", "int8"
+	case "uint8":
+		value, natural = "cs.ReadByte()", "uint8"
+	case "int16", "uint16":
+		m.scratch = true
+		m.printf("cs.ReadFull(b[:2])\n")
+		value, natural = order+".Uint16(b[:2])", "uint16"
+	case "int32", "uint32", "float32":
+		m.scratch = true
+		m.printf("cs.ReadFull(b[:4])\n")
+		value, natural = order+".Uint32(b[:4])", "uint32"
+	default:
+		m.scratch = true
+		m.printf("cs.ReadFull(b[:8])\n")
+		value, natural = order+".Uint64(b[:8])", "uint64"
+	}
+	switch basic {
+	case "int16", "int32", "int64":
+		value, natural = basic+"("+value+")", basic
+	case "int":
+		value, natural = "int64("+value+")", "int64"
+	case "float32":
+		g.imports["math"] = true
+		value, natural = "math.Float32frombits("+value+")", "float32"
+	case "float64":
+		g.imports["math"] = true
+		value, natural = "math.Float64frombits("+value+")", "float64"
+	}
+	if typ != natural && !(typ == "byte" && natural == "uint8") {
+		value = typ + "(" + value + ")"
+	}
+	m.printf("%s = %s\n", x, value)
+}
+
+func (g *generator) source(names []string) ([]byte, error) {
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "%s -type %s; DO NOT EDIT.\n\n", generatedComment, strings.Join(names, ","))
+	fmt.Fprintf(&src, "package %s\n\n", g.pkg)
+
+	var imports []string
+	for path := range g.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	src.WriteString("import (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&src, "%q\n", path)
+	}
+	if len(imports) > 0 {
+		src.WriteString("\n")
+	}
+	src.WriteString("\"github.com/lai323/bytecodec\"\n)\n\n")
+
+	if len(g.tagVars) > 0 {
+		src.WriteString("var (\n")
+		for _, d := range g.tagVars {
+			src.WriteString(d + "\n")
+		}
+		src.WriteString(")\n\n")
+	}
+	src.Write(g.buf.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v\n%s", err, src.Bytes())
+	}
+	return formatted, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 提交的生成代码需要和当前生成器的输出一致，修改生成器后需要在 internal/gentest 中执行 go generate
+func TestGeneratedUpToDate(t *testing.T) {
+	dir := filepath.Join("internal", "gentest")
+	want, err := ioutil.ReadFile(filepath.Join(dir, "packet_bytecodec.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate(dir, []string{"Packet", "Header", "Body", "LEHeader", "Numbers", "Blob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("internal/gentest/packet_bytecodec.go is out of date, run go generate\n%s", got)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	for _, c := range []struct {
+		src  string
+		want string
+	}{
+		{"type T struct{ A uint8 `bytecodec:\"bits:4\"` }", `tag "bits" is not supported`},
+		{"type T struct{ A uint8; C uint8 `bytecodec:\"checksum:xor\"` }", `tag "checksum" is not supported`},
+		{"type T struct{ A uint8 `bytecodec:\"sizeref:B\"`; B []uint16 }", `tag "sizeref" is not supported`},
+		{"type T struct{ A uint8; B []uint16 `bytecodec:\"length:A*2\"` }", `length expression "A*2" is not supported`},
+		{"type T struct{ A uint8 `bytecodec:\"lengthref:B..C\"`; B uint8; C string }", `lengthref "B..C" is not supported`},
+		{"type T struct{ A uint8 `bytecodec:\"lengthref:^.B\"` }", `lengthref "^.B" is not supported`},
+		{"type T struct{ A uint8 `bytecodec:\"lengthref:B\"` }", "lengthref field B not found"},
+		{"type T struct{ A string `bytecodec:\"lengthref:B\"`; B string }", "is not a number"},
+		{"type T int", "is not a struct"},
+		{"type U struct{}", "type T not found"},
+	} {
+		dir, err := ioutil.TempDir("", "bytecodecgen")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		src := "package p\n\n" + c.src + "\n"
+		if err := ioutil.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = generate(dir, []string{"T"})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%s: got error %v want %q", c.src, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package gentest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lai323/bytecodec"
+)
+
+// 这些类型和生成了方法的类型有相同的字段，但没有方法，会使用反射实现编解码
+type (
+	reflectPacket   Packet
+	reflectHeader   Header
+	reflectBody     Body
+	reflectLEHeader LEHeader
+	reflectNumbers  Numbers
+	reflectBlob     Blob
+)
+
+type gencase struct {
+	name      string
+	generated interface{} // 指向生成了方法的类型
+	reflected interface{} // 指向对应的反射类型，用于接收解码结果
+	convert   func(interface{}) interface{}
+}
+
+func newPacket() Packet {
+	return Packet{
+		Header: Header{MsgID: 0x0200, Props: 0x1234, Phone: "18102169375", SerialNo: 7},
+		Flag:   true,
+		Level:  -3,
+		Name:   "abcd",
+		Msg:    "你好",
+		IDs:    IDs{1, 2, 0xfffe},
+		Seq:    300,
+		Body: Body{
+			Items:  []int16{-1, 2},
+			Fixed:  [3]uint16{1, 2, 3},
+			Label:  "标签",
+			Note:   "note",
+			Remark: "备注",
+		},
+		Inner: LEHeader{Kind: 0x0102, Seq: 0x03040506},
+		Outer: LEHeader{Kind: 0x0102, Seq: 0x03040506},
+		Extra: &Header{MsgID: 1, Phone: "1", SerialNo: 2},
+		Attrs: map[uint8]string{1: "ab", 2: "cd"},
+		Tail:  []byte{0xaa, 0xbb},
+	}
+}
+
+func newNumbers() Numbers {
+	return Numbers{
+		I: -1, I8: -2, I16: -3, I32: -4, I64: -5,
+		U: 1, U8: 2, U16: 3, U32: 4, U64: 5, Ptr: 6,
+		F32: 1.5, F64: -2.25,
+		R: '中', B: 'b',
+		Bools:  [2]bool{true, false},
+		Floats: []float64{0.5, math.MaxFloat64},
+		Fixed:  []uint16{7, 8},
+	}
+}
+
+func gencases() []gencase {
+	p := newPacket()
+	n := newNumbers()
+	blob := Blob{Data: []byte{1, 2, 3}}
+	empty := Packet{Name: "    "}
+	return []gencase{
+		{"packet", &p, &reflectPacket{}, func(v interface{}) interface{} { return (*reflectPacket)(v.(*Packet)) }},
+		{"empty packet", &empty, &reflectPacket{}, func(v interface{}) interface{} { return (*reflectPacket)(v.(*Packet)) }},
+		{"header", &p.Header, &reflectHeader{}, func(v interface{}) interface{} { return (*reflectHeader)(v.(*Header)) }},
+		{"body", &p.Body, &reflectBody{}, func(v interface{}) interface{} { return (*reflectBody)(v.(*Body)) }},
+		{"le header", &p.Inner, &reflectLEHeader{}, func(v interface{}) interface{} { return (*reflectLEHeader)(v.(*LEHeader)) }},
+		{"numbers", &n, &reflectNumbers{}, func(v interface{}) interface{} { return (*reflectNumbers)(v.(*Numbers)) }},
+		{"blob", &blob, &reflectBlob{}, func(v interface{}) interface{} { return (*reflectBlob)(v.(*Blob)) }},
+	}
+}
+
+func TestGeneratedMatchesReflection(t *testing.T) {
+	for _, order := range []binary.ByteOrder{nil, binary.LittleEndian} {
+		mo := bytecodec.MarshalOptions{ByteOrder: order}
+		uo := bytecodec.UnmarshalOptions{ByteOrder: order}
+
+		for _, c := range gencases() {
+			want, err := mo.Marshal(c.convert(c.generated))
+			if err != nil {
+				t.Fatalf("%s: reflect Marshal error: %v", c.name, err)
+			}
+			got, err := mo.Marshal(c.generated)
+			if err != nil {
+				t.Fatalf("%s: generated Marshal error: %v", c.name, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s: generated Marshal\n got %#v\nwant %#v", c.name, got, want)
+			}
+			// 传入值时使用值接收者的 MarshalBytes
+			got, err = mo.Marshal(reflect.ValueOf(c.generated).Elem().Interface())
+			if err != nil || !bytes.Equal(got, want) {
+				t.Fatalf("%s: generated Marshal by value got %#v, %v want %#v", c.name, got, err, want)
+			}
+
+			gv := reflect.New(reflect.TypeOf(c.generated).Elem())
+			if err := uo.Unmarshal(want, gv.Interface()); err != nil {
+				t.Fatalf("%s: generated Unmarshal error: %v", c.name, err)
+			}
+			if err := uo.Unmarshal(want, c.reflected); err != nil {
+				t.Fatalf("%s: reflect Unmarshal error: %v", c.name, err)
+			}
+			if !reflect.DeepEqual(c.convert(gv.Interface()), c.reflected) {
+				t.Fatalf("%s: generated Unmarshal\n got %#v\nwant %#v", c.name, gv.Elem().Interface(), reflect.ValueOf(c.reflected).Elem().Interface())
+			}
+		}
+	}
+}
+
+func TestGeneratedStreamDecode(t *testing.T) {
+	n := newNumbers()
+	p := newPacket()
+	var buf bytes.Buffer
+	enc := bytecodec.NewEncoder(&buf)
+	if err := enc.Encode(&n); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&p.Header); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := bytecodec.NewDecoder(bytes.NewReader(buf.Bytes()))
+	var gotN Numbers
+	var gotH Header
+	if err := dec.Decode(&gotN); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&gotH); err != nil {
+		t.Fatal(err)
+	}
+	var wantN reflectNumbers
+	var wantH reflectHeader
+	dec = bytecodec.NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err := dec.Decode(&wantN); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&wantH); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual((*reflectNumbers)(&gotN), &wantN) || !reflect.DeepEqual((*reflectHeader)(&gotH), &wantH) {
+		t.Fatalf("got %#v %#v want %#v %#v", gotN, gotH, wantN, wantH)
+	}
+
+	// Packet 的 Attrs 没有长度，流式解码时无法确定结束位置
+	b, err := bytecodec.Marshal(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bytecodec.NewDecoder(bytes.NewReader(b)).Decode(&Packet{}); !errors.Is(err, bytecodec.ErrUnbounded) {
+		t.Fatalf("generated Decode got error %v want ErrUnbounded", err)
+	}
+	if err := bytecodec.NewDecoder(bytes.NewReader(b)).Decode(&reflectPacket{}); !errors.Is(err, bytecodec.ErrUnbounded) {
+		t.Fatalf("reflect Decode got error %v want ErrUnbounded", err)
+	}
+}
+
+// cause 去掉反射实现添加的 FieldError，生成的代码不记录字段路径
+func cause(err error) error {
+	var fe *bytecodec.FieldError
+	for errors.As(err, &fe) {
+		err = fe.Err
+	}
+	return err
+}
+
+func TestGeneratedErrors(t *testing.T) {
+	for _, mutate := range []func(*Packet){
+		func(p *Packet) { p.Name = "abc" },
+		func(p *Packet) { p.Header.Phone = "phone" },
+		func(p *Packet) { p.Msg = "\U0001F600" },
+		func(p *Packet) { p.Msg = strings.Repeat("a", 256) },
+	} {
+		p := newPacket()
+		mutate(&p)
+		_, want := bytecodec.Marshal((*reflectPacket)(&p))
+		want = cause(want)
+		_, got := bytecodec.Marshal(&p)
+		if want == nil || got == nil || got.Error() != want.Error() {
+			t.Fatalf("got error %v want %v", got, want)
+		}
+	}
+
+	n := newNumbers()
+	n.F32 = float32(math.Inf(1))
+	_, want := bytecodec.Marshal((*reflectNumbers)(&n))
+	want = cause(want)
+	_, got := bytecodec.Marshal(&n)
+	if want == nil || got == nil || got.Error() != want.Error() {
+		t.Fatalf("got error %v want %v", got, want)
+	}
+
+	n = newNumbers()
+	n.Fixed = []uint16{1}
+	_, want = bytecodec.Marshal((*reflectNumbers)(&n))
+	want = cause(want)
+	_, got = bytecodec.Marshal(&n)
+	if want == nil || got == nil || got.Error() != want.Error() {
+		t.Fatalf("got error %v want %v", got, want)
+	}
+}
+
+// 数据不完整时生成的代码和反射实现返回相同的错误
+// 没有数据时 bytecodec 不调用 UnmarshalBytes，和反射实现不解码结构体一样返回 nil
+func TestGeneratedTruncated(t *testing.T) {
+	for _, c := range gencases() {
+		data, err := bytecodec.Marshal(c.generated)
+		if err != nil {
+			t.Fatalf("%s: Marshal error: %v", c.name, err)
+		}
+		for i := 0; i < len(data); i++ {
+			want := cause(bytecodec.Unmarshal(data[:i], reflect.New(reflect.TypeOf(c.reflected).Elem()).Interface()))
+			got := cause(bytecodec.Unmarshal(data[:i], reflect.New(reflect.TypeOf(c.generated).Elem()).Interface()))
+			if (got == nil) != (want == nil) || got != nil && got.Error() != want.Error() {
+				t.Errorf("%s: %d of %d bytes got error %v want %v", c.name, i, len(data), got, want)
+			}
+		}
+	}
+}
+
+// 解码得到的 lengthref 的值是负数或者超出 int 的范围时，生成的代码和反射实现返回相同的错误
+func TestGeneratedBadLength(t *testing.T) {
+	n := newNumbers()
+	n.Floats = nil
+	negative, err := bytecodec.Marshal(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	negative[73] = 0x01 // zigzag 编码的 VarLen，值为 -1
+
+	for _, c := range []struct {
+		name                 string
+		data                 []byte
+		generated, reflected interface{}
+	}{
+		{"negative", negative, &Numbers{}, &reflectNumbers{}},
+		{"overflow", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1}, &Blob{}, &reflectBlob{}},
+	} {
+		want := cause(bytecodec.Unmarshal(c.data, c.reflected))
+		got := cause(bytecodec.Unmarshal(c.data, c.generated))
+		if want == nil || got == nil || got.Error() != want.Error() {
+			t.Errorf("%s: got error %v want %v", c.name, got, want)
+		}
+	}
+}
+
+// wrap 标签的 lengthref 超出范围时和反射实现一样只保留低位
+func TestGeneratedWrap(t *testing.T) {
+	p := newPacket()
+	p.Tail = make([]byte, 300)
+	want, err := bytecodec.Marshal((*reflectPacket)(&p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := bytecodec.Marshal(&p)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("got %#v, %v want %#v", got, err, want)
+	}
+}
+
+func BenchmarkMarshalGenerated(b *testing.B) {
+	n := newNumbers()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bytecodec.Marshal(&n)
+	}
+}
+
+func BenchmarkMarshalReflect(b *testing.B) {
+	n := newNumbers()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		bytecodec.Marshal((*reflectNumbers)(&n))
+	}
+}
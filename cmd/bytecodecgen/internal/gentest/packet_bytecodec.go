@@ -0,0 +1,418 @@
+// Code generated by bytecodecgen -type Packet,Header,Body,LEHeader,Numbers,Blob; DO NOT EDIT.
+
+package gentest
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/lai323/bytecodec"
+)
+
+var (
+	bytecodecTagPacketHeader  = bytecodec.ParseFieldTag("")
+	bytecodecTagPacketName    = bytecodec.ParseFieldTag("length:4")
+	bytecodecTagPacketMsg     = bytecodec.ParseFieldTag("gbk")
+	bytecodecTagPacketSeq     = bytecodec.ParseFieldTag("uvarint")
+	bytecodecTagPacketBody    = bytecodec.ParseFieldTag("")
+	bytecodecTagPacketInner   = bytecodec.ParseFieldTag("be")
+	bytecodecTagPacketOuter   = bytecodec.ParseFieldTag("")
+	bytecodecTagPacketExtra   = bytecodec.ParseFieldTag("")
+	bytecodecTagPacketAttrs   = bytecodec.ParseFieldTag("value.length:2")
+	bytecodecTagHeaderPhone   = bytecodec.ParseFieldTag("bcd8421:6,true")
+	bytecodecTagBodyLabel     = bytecodec.ParseFieldTag("gbk;length:6;pad:nul;truncate")
+	bytecodecTagBodyNote      = bytecodec.ParseFieldTag("cstring:8")
+	bytecodecTagBodyRemark    = bytecodec.ParseFieldTag("gbk")
+	bytecodecTagNumbersVarLen = bytecodec.ParseFieldTag("zigzag;lengthref:Floats")
+)
+
+// MarshalBytes 实现 bytecodec.ByteCoder
+func (v Packet) MarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	cs.EncodeField(v.Header, bytecodecTagPacketHeader)
+	if v.Flag {
+		cs.WriteByte(1)
+	} else {
+		cs.WriteByte(0)
+	}
+	cs.WriteByte(byte(v.Level))
+	cs.Write(cs.StringBytes(v.Name, bytecodecTagPacketName))
+	bMsg := cs.StringBytes(v.Msg, bytecodecTagPacketMsg)
+	nMsg := len(bMsg)
+	cs.CheckOverflow("MsgLength", int64(nMsg), 8, false)
+	cs.WriteByte(byte(nMsg))
+	cs.Write(bMsg)
+	nIDs := len(v.IDs)
+	cs.CheckOverflow("NumIDs", int64(nIDs), 16, false)
+	order.PutUint16(b[:2], uint16(nIDs))
+	cs.Write(b[:2])
+	for _, e := range v.IDs {
+		order.PutUint16(b[:2], uint16(e))
+		cs.Write(b[:2])
+	}
+	cs.EncodeField(v.Seq, bytecodecTagPacketSeq)
+	bBody, nBody := cs.FieldBytes(v.Body, bytecodecTagPacketBody)
+	cs.CheckOverflow("BodyLen", int64(nBody), 16, false)
+	order.PutUint16(b[:2], uint16(nBody))
+	cs.Write(b[:2])
+	cs.Write(bBody)
+	cs.EncodeField(v.Inner, bytecodecTagPacketInner)
+	cs.EncodeField(v.Outer, bytecodecTagPacketOuter)
+	cs.EncodeField(v.Extra, bytecodecTagPacketExtra)
+	nTail := len(v.Tail)
+	cs.WriteByte(byte(nTail))
+	for _, e := range v.Tail {
+		cs.WriteByte(byte(e))
+	}
+	cs.EncodeField(v.Attrs, bytecodecTagPacketAttrs)
+	return nil
+}
+
+// UnmarshalBytes 实现 bytecodec.ByteCoder
+func (v *Packet) UnmarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	cs.DecodeField(&v.Header, bytecodecTagPacketHeader, -1)
+	v.Flag = cs.ReadByte() != 0
+	v.Level = int8(cs.ReadByte())
+	cs.DecodeString(&v.Name, bytecodecTagPacketName, -1)
+	v.MsgLength = cs.ReadByte()
+	nMsg := cs.RefLengthUint("MsgLength", uint64(v.MsgLength))
+	cs.DecodeString(&v.Msg, bytecodecTagPacketMsg, nMsg)
+	cs.ReadFull(b[:2])
+	v.NumIDs = order.Uint16(b[:2])
+	nIDs := cs.RefLengthUint("NumIDs", uint64(v.NumIDs))
+	cs.CheckBounded(nIDs)
+	{
+		i := 0
+		for ; (nIDs < 0 || i < nIDs) && cs.More(); i++ {
+			var e MsgID
+			cs.ReadFull(b[:2])
+			e = MsgID(order.Uint16(b[:2]))
+			if i < len(v.IDs) {
+				v.IDs[i] = e
+			} else {
+				v.IDs = append(v.IDs, e)
+			}
+		}
+		if i == 0 {
+			v.IDs = IDs{}
+		}
+	}
+	cs.DecodeField(&v.Seq, bytecodecTagPacketSeq, -1)
+	cs.ReadFull(b[:2])
+	v.BodyLen = order.Uint16(b[:2])
+	nBody := cs.RefLengthUint("BodyLen", uint64(v.BodyLen))
+	cs.DecodeField(&v.Body, bytecodecTagPacketBody, nBody)
+	cs.DecodeField(&v.Inner, bytecodecTagPacketInner, -1)
+	cs.DecodeField(&v.Outer, bytecodecTagPacketOuter, -1)
+	cs.DecodeField(&v.Extra, bytecodecTagPacketExtra, -1)
+	v.TailLen = cs.ReadByte()
+	nTail := cs.RefLengthUint("TailLen", uint64(v.TailLen))
+	cs.CheckBounded(nTail)
+	{
+		i := 0
+		for ; (nTail < 0 || i < nTail) && cs.More(); i++ {
+			var e byte
+			e = cs.ReadByte()
+			if i < len(v.Tail) {
+				v.Tail[i] = e
+			} else {
+				v.Tail = append(v.Tail, e)
+			}
+		}
+		if i == 0 {
+			v.Tail = []byte{}
+		}
+	}
+	cs.DecodeField(&v.Attrs, bytecodecTagPacketAttrs, -1)
+	return nil
+}
+
+// MarshalBytes 实现 bytecodec.ByteCoder
+func (v Header) MarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	order.PutUint16(b[:2], uint16(v.MsgID))
+	cs.Write(b[:2])
+	binary.LittleEndian.PutUint16(b[:2], uint16(v.Props))
+	cs.Write(b[:2])
+	cs.Write(cs.StringBytes(string(v.Phone), bytecodecTagHeaderPhone))
+	order.PutUint16(b[:2], uint16(v.SerialNo))
+	cs.Write(b[:2])
+	return nil
+}
+
+// UnmarshalBytes 实现 bytecodec.ByteCoder
+func (v *Header) UnmarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	cs.ReadFull(b[:2])
+	v.MsgID = MsgID(order.Uint16(b[:2]))
+	cs.ReadFull(b[:2])
+	v.Props = binary.LittleEndian.Uint16(b[:2])
+	{
+		s := string(v.Phone)
+		cs.DecodeString(&s, bytecodecTagHeaderPhone, -1)
+		v.Phone = Phone(s)
+	}
+	cs.ReadFull(b[:2])
+	v.SerialNo = order.Uint16(b[:2])
+	return nil
+}
+
+// MarshalBytes 实现 bytecodec.ByteCoder
+func (v Body) MarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	nItems := len(v.Items)
+	cs.CheckOverflow("Count", int64(nItems), 8, false)
+	cs.WriteByte(byte(nItems))
+	for _, e := range v.Items {
+		order.PutUint16(b[:2], uint16(e))
+		cs.Write(b[:2])
+	}
+	for _, e := range v.Fixed {
+		order.PutUint16(b[:2], uint16(e))
+		cs.Write(b[:2])
+	}
+	cs.Write(cs.StringBytes(v.Label, bytecodecTagBodyLabel))
+	cs.Write(cs.StringBytes(v.Note, bytecodecTagBodyNote))
+	cs.Write(cs.StringBytes(v.Remark, bytecodecTagBodyRemark))
+	return nil
+}
+
+// UnmarshalBytes 实现 bytecodec.ByteCoder
+func (v *Body) UnmarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	v.Count = cs.ReadByte()
+	nItems := cs.RefLengthUint("Count", uint64(v.Count))
+	cs.CheckBounded(nItems)
+	{
+		i := 0
+		for ; (nItems < 0 || i < nItems) && cs.More(); i++ {
+			var e int16
+			cs.ReadFull(b[:2])
+			e = int16(order.Uint16(b[:2]))
+			if i < len(v.Items) {
+				v.Items[i] = e
+			} else {
+				v.Items = append(v.Items, e)
+			}
+		}
+		if i == 0 {
+			v.Items = []int16{}
+		}
+	}
+	{
+		i := 0
+		for ; i < len(v.Fixed) && cs.More(); i++ {
+			cs.ReadFull(b[:2])
+			v.Fixed[i] = order.Uint16(b[:2])
+		}
+		for ; i < len(v.Fixed); i++ {
+			v.Fixed[i] = 0
+		}
+	}
+	cs.DecodeString(&v.Label, bytecodecTagBodyLabel, -1)
+	cs.DecodeString(&v.Note, bytecodecTagBodyNote, -1)
+	cs.DecodeString(&v.Remark, bytecodecTagBodyRemark, -1)
+	return nil
+}
+
+// MarshalBytes 实现 bytecodec.ByteCoder
+func (v LEHeader) MarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.StructByteOrder(binary.LittleEndian)
+	var b [8]byte
+	order.PutUint16(b[:2], uint16(v.Kind))
+	cs.Write(b[:2])
+	binary.BigEndian.PutUint32(b[:4], uint32(v.Seq))
+	cs.Write(b[:4])
+	return nil
+}
+
+// UnmarshalBytes 实现 bytecodec.ByteCoder
+func (v *LEHeader) UnmarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.StructByteOrder(binary.LittleEndian)
+	var b [8]byte
+	cs.ReadFull(b[:2])
+	v.Kind = order.Uint16(b[:2])
+	cs.ReadFull(b[:4])
+	v.Seq = binary.BigEndian.Uint32(b[:4])
+	return nil
+}
+
+// MarshalBytes 实现 bytecodec.ByteCoder
+func (v Numbers) MarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.StructByteOrder(binary.LittleEndian)
+	var b [8]byte
+	order.PutUint64(b[:8], uint64(v.I))
+	cs.Write(b[:8])
+	cs.WriteByte(byte(v.I8))
+	order.PutUint16(b[:2], uint16(v.I16))
+	cs.Write(b[:2])
+	order.PutUint32(b[:4], uint32(v.I32))
+	cs.Write(b[:4])
+	binary.BigEndian.PutUint64(b[:8], uint64(v.I64))
+	cs.Write(b[:8])
+	order.PutUint64(b[:8], uint64(v.U))
+	cs.Write(b[:8])
+	cs.WriteByte(byte(v.U8))
+	order.PutUint16(b[:2], uint16(v.U16))
+	cs.Write(b[:2])
+	order.PutUint32(b[:4], uint32(v.U32))
+	cs.Write(b[:4])
+	order.PutUint64(b[:8], uint64(v.U64))
+	cs.Write(b[:8])
+	order.PutUint64(b[:8], uint64(v.Ptr))
+	cs.Write(b[:8])
+	cs.CheckFloat(float64(v.F32), 32)
+	order.PutUint32(b[:4], math.Float32bits(float32(v.F32)))
+	cs.Write(b[:4])
+	cs.CheckFloat(float64(v.F64), 64)
+	order.PutUint64(b[:8], math.Float64bits(float64(v.F64)))
+	cs.Write(b[:8])
+	order.PutUint32(b[:4], uint32(v.R))
+	cs.Write(b[:4])
+	cs.WriteByte(byte(v.B))
+	for _, e := range v.Bools {
+		if e {
+			cs.WriteByte(1)
+		} else {
+			cs.WriteByte(0)
+		}
+	}
+	nFloats := len(v.Floats)
+	cs.CheckOverflow("VarLen", int64(nFloats), 32, true)
+	cs.EncodeField(int32(nFloats), bytecodecTagNumbersVarLen)
+	for _, e := range v.Floats {
+		cs.CheckFloat(float64(e), 64)
+		binary.BigEndian.PutUint64(b[:8], math.Float64bits(float64(e)))
+		cs.Write(b[:8])
+	}
+	for _, e := range v.Fixed {
+		order.PutUint16(b[:2], uint16(e))
+		cs.Write(b[:2])
+	}
+	cs.CheckLength(len(v.Fixed), 2)
+	return nil
+}
+
+// UnmarshalBytes 实现 bytecodec.ByteCoder
+func (v *Numbers) UnmarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.StructByteOrder(binary.LittleEndian)
+	var b [8]byte
+	cs.ReadFull(b[:8])
+	v.I = int(int64(order.Uint64(b[:8])))
+	v.I8 = int8(cs.ReadByte())
+	cs.ReadFull(b[:2])
+	v.I16 = int16(order.Uint16(b[:2]))
+	cs.ReadFull(b[:4])
+	v.I32 = int32(order.Uint32(b[:4]))
+	cs.ReadFull(b[:8])
+	v.I64 = int64(binary.BigEndian.Uint64(b[:8]))
+	cs.ReadFull(b[:8])
+	v.U = uint(order.Uint64(b[:8]))
+	v.U8 = cs.ReadByte()
+	cs.ReadFull(b[:2])
+	v.U16 = order.Uint16(b[:2])
+	cs.ReadFull(b[:4])
+	v.U32 = order.Uint32(b[:4])
+	cs.ReadFull(b[:8])
+	v.U64 = order.Uint64(b[:8])
+	cs.ReadFull(b[:8])
+	v.Ptr = uintptr(order.Uint64(b[:8]))
+	cs.ReadFull(b[:4])
+	v.F32 = math.Float32frombits(order.Uint32(b[:4]))
+	cs.ReadFull(b[:8])
+	v.F64 = math.Float64frombits(order.Uint64(b[:8]))
+	cs.ReadFull(b[:4])
+	v.R = rune(int32(order.Uint32(b[:4])))
+	v.B = cs.ReadByte()
+	{
+		i := 0
+		for ; i < len(v.Bools) && cs.More(); i++ {
+			v.Bools[i] = cs.ReadByte() != 0
+		}
+		for ; i < len(v.Bools); i++ {
+			v.Bools[i] = false
+		}
+	}
+	cs.DecodeField(&v.VarLen, bytecodecTagNumbersVarLen, -1)
+	nFloats := cs.RefLength("VarLen", int64(v.VarLen))
+	cs.CheckBounded(nFloats)
+	{
+		i := 0
+		for ; (nFloats < 0 || i < nFloats) && cs.More(); i++ {
+			var e float64
+			cs.ReadFull(b[:8])
+			e = math.Float64frombits(binary.BigEndian.Uint64(b[:8]))
+			if i < len(v.Floats) {
+				v.Floats[i] = e
+			} else {
+				v.Floats = append(v.Floats, e)
+			}
+		}
+		if i == 0 {
+			v.Floats = []float64{}
+		}
+	}
+	{
+		i := 0
+		for ; i < 2 && cs.More(); i++ {
+			var e uint16
+			cs.ReadFull(b[:2])
+			e = order.Uint16(b[:2])
+			if i < len(v.Fixed) {
+				v.Fixed[i] = e
+			} else {
+				v.Fixed = append(v.Fixed, e)
+			}
+		}
+		if i == 0 {
+			v.Fixed = []uint16{}
+		}
+	}
+	return nil
+}
+
+// MarshalBytes 实现 bytecodec.ByteCoder
+func (v Blob) MarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	nData := len(v.Data)
+	order.PutUint64(b[:8], uint64(nData))
+	cs.Write(b[:8])
+	for _, e := range v.Data {
+		cs.WriteByte(byte(e))
+	}
+	return nil
+}
+
+// UnmarshalBytes 实现 bytecodec.ByteCoder
+func (v *Blob) UnmarshalBytes(cs *bytecodec.CodecState) error {
+	order := cs.ByteOrder()
+	var b [8]byte
+	cs.ReadFull(b[:8])
+	v.Len = order.Uint64(b[:8])
+	nData := cs.RefLengthUint("Len", uint64(v.Len))
+	cs.CheckBounded(nData)
+	{
+		i := 0
+		for ; (nData < 0 || i < nData) && cs.More(); i++ {
+			var e byte
+			e = cs.ReadByte()
+			if i < len(v.Data) {
+				v.Data[i] = e
+			} else {
+				v.Data = append(v.Data, e)
+			}
+		}
+		if i == 0 {
+			v.Data = []byte{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// gentest 中的类型用于比较 bytecodecgen 生成的代码和反射实现的编解码结果
+package gentest
+
+//go:generate go run github.com/lai323/bytecodec/cmd/bytecodecgen -type Packet,Header,Body,LEHeader,Numbers,Blob -output packet_bytecodec.go
+
+type MsgID uint16
+
+type Phone string
+
+type IDs []MsgID
+
+type Header struct {
+	MsgID    MsgID
+	Props    uint16 `bytecodec:"le"`
+	Phone    Phone  `bytecodec:"bcd8421:6,true"`
+	SerialNo uint16
+}
+
+// LEHeader 声明了小端序，作为字段使用时可以被字段的 be 标签覆盖
+type LEHeader struct {
+	_    struct{} `bytecodec:"le"`
+	Kind uint16
+	Seq  uint32 `bytecodec:"be"`
+}
+
+type Body struct {
+	Count  uint8 `bytecodec:"lengthref:Items"`
+	Items  []int16
+	Fixed  [3]uint16
+	Label  string `bytecodec:"gbk;length:6;pad:nul;truncate"`
+	Note   string `bytecodec:"cstring:8"`
+	Remark string `bytecodec:"gbk"`
+}
+
+type Packet struct {
+	Header    Header
+	Flag      bool
+	Level     int8
+	Name      string `bytecodec:"length:4"`
+	MsgLength uint8  `bytecodec:"lengthref:Msg"`
+	Msg       string `bytecodec:"gbk"`
+	NumIDs    uint16 `bytecodec:"lengthref:IDs"`
+	IDs       IDs
+	Seq       uint32 `bytecodec:"uvarint"`
+	BodyLen   uint16 `bytecodec:"lengthref:Body"`
+	Body      Body
+	Inner     LEHeader `bytecodec:"be"`
+	Outer     LEHeader
+	Extra     *Header
+	TailLen   uint8 `bytecodec:"lengthref:Tail;wrap"` // 超过 255 字节时只保留长度的低 8 位
+	Tail      []byte
+	Attrs     map[uint8]string `bytecodec:"value.length:2"`
+	internal  int
+}
+
+type Numbers struct {
+	_       struct{} `bytecodec:"le"`
+	I       int
+	I8      int8
+	I16     int16
+	I32     int32
+	I64     int64 `bytecodec:"be"`
+	U       uint
+	U8      uint8
+	U16     uint16
+	U32     uint32
+	U64     uint64
+	Ptr     uintptr
+	F32     float32
+	F64     float64
+	R       rune
+	B       byte
+	Bools   [2]bool
+	VarLen  int32     `bytecodec:"zigzag;lengthref:Floats"`
+	Floats  []float64 `bytecodec:"be"`
+	Skipped string    `bytecodec:"-"`
+	Fixed   []uint16  `bytecodec:"length:2"`
+}
+
+type Blob struct {
+	Len  uint64 `bytecodec:"lengthref:Data"`
+	Data []byte
+}
@@ -0,0 +1,67 @@
+// bytecodecgen 为结构体生成 bytecodec.ByteCoder 的 MarshalBytes、UnmarshalBytes 方法
+// 生成的方法直接读写字段，不经过 reflect.Value 和每个字段的子 CodecState，编码结果和反射实现完全一致
+//
+// 用法:
+//
+//	bytecodecgen -type Packet,Header [-output packet_bytecodec.go] [dir]
+//
+// 一般通过 go:generate 使用:
+//
+//	//go:generate go run github.com/lai323/bytecodec/cmd/bytecodecgen -type Packet,Header
+//
+// 固定长度的数值、bool、string 以及它们的 slice、array 直接生成读写代码
+// 嵌套结构体、指针、map、变长整数等字段调用 CodecState 的 EncodeField、DecodeField，由反射实现处理
+// 包含 bits、checksum、if、switch 标签的结构体不能生成，会返回错误
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; must be set")
+	output    = flag.String("output", "", "output file name; default srcdir/<type>_bytecodec.go")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage of bytecodecgen:\n")
+	fmt.Fprintf(os.Stderr, "\tbytecodecgen -type T,U [-output file] [directory]\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bytecodecgen: ")
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	types := strings.Split(*typeNames, ",")
+
+	src, err := generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, strings.ToLower(types[0])+"_bytecodec.go")
+	}
+	if err := ioutil.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatalf("writing output: %s", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
 	"strconv"
@@ -85,8 +86,48 @@ func newPointerTrack() pointerTrack {
 
 type CodecState struct {
 	bytes.Buffer
-	pt *pointerTrack
-	v  map[string]interface{}
+	pt    *pointerTrack
+	v     map[string]interface{}
+	order binary.ByteOrder
+	r     io.Reader // 流式解码时的数据来源，缓冲区中的数据不足时从 r 中读取
+
+	// order 来自外层字段的字节序标签，这时 ByteCoder 中结构体声明的字节序不会覆盖它
+	tagOrder bool
+
+	// 正在解码的结构体，子 CodecState 共享外层的部分
+	// 解码过程中的状态都保存在这里，缓存的 codec 和 structFields 不会被修改
+	frames []*decodeFrame
+
+	encoders       []*structEncoder // 正在编码的结构体，用于查找 lengthref:^.Body 指向的外层结构体
+	pendingRefs    []pendingRef     // 交给下一个编码的结构体的跨结构体 lengthref
+	pendingLengths []pendingLength  // 交给下一个解码的结构体的跨结构体 lengthref 长度
+	held           []*structEncoder // 编码完成但还有跨结构体 lengthref 等待回填或者推迟计算校验值的结构体
+
+	recs []*bytes.Buffer // 记录读取过的字节，用于计算校验值
+	off  int             // 已经读取的字节数
+	base int             // 子 CodecState 的数据在外层输入或输出中的起始位置，用于计算 FieldError 中的位置
+
+	path    []pathEntry  // 正在编解码的字段路径，子 CodecState 共享外层的部分
+	pathBuf [8]pathEntry // path 使用的初始空间
+
+	scratch [8]byte // 编码数值类型时使用的临时缓冲区
+}
+
+// decodeFrame 保存一次结构体解码过程中通过 lengthref 解析得到的长度
+type decodeFrame struct {
+	sc      structCoder
+	cur     int                     // 正在解码的字段下标
+	lengths map[int]int             // 字段在 structFields.list 中的下标 -> 长度
+	refs    map[int]field           // 长度来自其他结构体中的 lengthref 字段时，字段下标 -> lengthref 字段
+	pending map[int][]pendingLength // 交给内层结构体字段的长度
+	bits    *bitReader              // 正在读取的连续 bits 字段
+}
+
+func (f *decodeFrame) setLength(index, length int) {
+	if f.lengths == nil {
+		f.lengths = map[int]int{}
+	}
+	f.lengths[index] = length
 }
 
 const startDetectingCyclesAfter = 1000
@@ -103,9 +144,29 @@ func subCodecState(pt *pointerTrack) *CodecState {
 		e := v.(*CodecState)
 		e.Reset()
 		e.pt = pt
+		for k := range e.v {
+			delete(e.v, k)
+		}
+		e.order = nil
+		e.tagOrder = false
+		e.r = nil
+		e.frames = nil
+		e.encoders = e.encoders[:0] // 出栈时已经清除了指针，保留容量
+		e.pendingRefs = nil
+		e.pendingLengths = nil
+		for i := range e.held {
+			e.held[i] = nil
+		}
+		e.held = e.held[:0]
+		e.recs = nil
+		e.off = 0
+		e.base = 0
+		e.path = e.pathBuf[:0]
 		return e
 	}
-	return &CodecState{pt: pt}
+	e := &CodecState{pt: pt}
+	e.path = e.pathBuf[:0]
+	return e
 }
 
 func (c *CodecState) marshal(v interface{}) error {
@@ -118,7 +179,41 @@ func (c *CodecState) unmarshal(v reflect.Value) error {
 }
 
 func (c *CodecState) gensub() *CodecState {
-	return subCodecState(c.pt)
+	sub := subCodecState(c.pt)
+	sub.order = c.order
+	sub.frames = c.frames
+	sub.pendingLengths = c.pendingLengths
+	sub.path = c.path
+	sub.base = c.base + c.off
+	return sub
+}
+
+func (c *CodecState) pushFrame(sc structCoder) *decodeFrame {
+	f := &decodeFrame{sc: sc, cur: -1}
+	c.frames = append(c.frames, f)
+	return f
+}
+
+func (c *CodecState) popFrame() {
+	c.frames[len(c.frames)-1] = nil
+	c.frames = c.frames[:len(c.frames)-1]
+}
+
+// ByteOrder 返回当前使用的默认字节序，未设置时为大端序
+// 自定义 ByteCoder 可以使用它保持和外层结构一致的字节序
+func (c *CodecState) ByteOrder() binary.ByteOrder {
+	if c.order == nil {
+		return binary.BigEndian
+	}
+	return c.order
+}
+
+// byteOrder 返回字段实际使用的字节序，字段标签优先于当前默认字节序
+func (c *CodecState) byteOrder(to tagOptions) binary.ByteOrder {
+	if to.byteOrder != nil {
+		return to.byteOrder
+	}
+	return c.ByteOrder()
 }
 
 func (c *CodecState) set(k string, v interface{}) {
@@ -132,13 +227,31 @@ func (c *CodecState) get(k string) interface{} {
 	return c.v[k]
 }
 
+// encodedLength 返回 lengthref 使用的长度，string 为字节长度，slice、map 为元素个数
+// 其他类型，例如自定义 ByteCoder，使用编码后的字节长度 n
+func encodedLength(c *CodecState, n int) int {
+	if length, ok := c.get("length").(int); ok {
+		return length
+	}
+	return n
+}
+
 type bytecodecError struct{ error }
 
 func (c *CodecState) code(f func(e *CodecState, v reflect.Value, to tagOptions), v reflect.Value) (err error) {
+	// 在自定义 ByteCoder 中嵌套调用时，错误中的路径从 v 开始
+	path := c.path
+	c.path = c.path[len(c.path):]
 	defer func() {
+		c.path = path
 		if r := recover(); r != nil {
 			if be, ok := r.(bytecodecError); ok {
 				err = be.error
+				if fe, ok := err.(*FieldError); ok {
+					if name := rootName(v); name != "" {
+						fe.Path = name + "." + fe.Path
+					}
+				}
 			} else {
 				panic(r)
 			}
@@ -149,22 +262,103 @@ func (c *CodecState) code(f func(e *CodecState, v reflect.Value, to tagOptions),
 }
 
 func (c *CodecState) error(err error) {
-	panic(bytecodecError{err})
+	panic(bytecodecError{c.fieldError(err)})
 }
 
 var ErrShortData = errors.New("short data")
 
+// ErrUnbounded 表示流式解码时字段没有指定长度，也不在 lengthref 等限定的范围内，无法确定需要读取的字节数
+var ErrUnbounded = errors.New("field has no length in a stream")
+
+// unbounded 在流式解码时返回 ErrUnbounded，lengthref 等限定的范围内 c 是没有 r 的子 CodecState
+func (c *CodecState) unbounded() {
+	if c.r != nil {
+		c.error(ErrUnbounded)
+	}
+}
+
+// fill 在流式解码时从 r 中读取数据，直到缓冲区中至少有 n 个字节
+// 返回缓冲区中的数据是否足够，只会读取需要的字节，不会多读
+func (c *CodecState) fill(n int) bool {
+	if c.r == nil || c.Buffer.Len() >= n {
+		return c.Buffer.Len() >= n
+	}
+	_, err := io.CopyN(&c.Buffer, c.r, int64(n-c.Buffer.Len()))
+	if err != nil && err != io.EOF {
+		c.error(err)
+	}
+	return c.Buffer.Len() >= n
+}
+
+// more 返回是否还有未读取的数据，流式解码时可能会阻塞等待数据
+func (c *CodecState) more() bool {
+	return c.fill(1)
+}
+
+// readRemaining 读取全部剩余数据，流式解码时会一直读取到 io.EOF
+// 字段解码时需要先调用 unbounded，只有检查剩余数据时才会在流上读取到 io.EOF
+// 在 lengthref 限定的范围内解码时，剩余数据只包含这个范围内的字节
+func (c *CodecState) readRemaining() []byte {
+	if c.r != nil {
+		if _, err := c.Buffer.ReadFrom(c.r); err != nil {
+			c.error(err)
+		}
+	}
+	b := make([]byte, c.Len())
+	c.ReadFull(b)
+	return b
+}
+
+// readLimited 读取从输入中解码得到的 n 个字节，例如 lengthref 的长度
+// 先确认有足够的数据再分配空间，避免不可信的长度导致分配过大的空间，流式解码时 fill 随着读到的数据增加缓冲区
+func (c *CodecState) readLimited(n int) []byte {
+	if !c.fill(n) {
+		// 和 ReadFull 一样，数据不足时剩余的数据也被读取
+		c.Next(c.Len())
+		c.error(ErrShortData)
+	}
+	b := make([]byte, n)
+	c.ReadFull(b)
+	return b
+}
+
+// startRecord 开始记录之后通过 ReadFull、ReadByte 读取的字节
+func (c *CodecState) startRecord() *bytes.Buffer {
+	rec := &bytes.Buffer{}
+	c.recs = append(c.recs, rec)
+	return rec
+}
+
+func (c *CodecState) stopRecord(rec *bytes.Buffer) {
+	for i := range c.recs {
+		if c.recs[i] == rec {
+			c.recs = append(c.recs[:i], c.recs[i+1:]...)
+			return
+		}
+	}
+}
+
 func (c *CodecState) ReadFull(p []byte) {
+	c.fill(len(p))
 	n, err := c.Buffer.Read(p)
 	if err != nil || n != len(p) {
-		c.error(bytecodecError{ErrShortData})
+		c.error(ErrShortData)
+	}
+	c.off += n
+	for _, rec := range c.recs {
+		rec.Write(p)
 	}
 }
 
 func (c *CodecState) ReadByte() byte {
+	c.fill(1)
 	b, err := c.Buffer.ReadByte()
 	if err != nil {
-		c.error(bytecodecError{ErrShortData})
+		c.error(ErrShortData)
+	}
+	c.off++
+	for _, rec := range c.recs {
+		rec.WriteByte(b)
 	}
 	return b
 }
@@ -285,6 +479,8 @@ func newTypeCodec(t reflect.Type, allowAddr bool) codec {
 		return newArrayCoder(t)
 	case reflect.Slice:
 		return newSliceCoder(t)
+	case reflect.Map:
+		return newMapCoder(t)
 	case reflect.Ptr:
 		return newPtrCoder(t)
 	default:
@@ -311,11 +507,12 @@ func (byteCoderCoder) typ() reflect.Kind {
 	return reflect.Invalid
 }
 
-func (byteCoderCoder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (byteCoderCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 	if v.Kind() == reflect.Ptr && v.IsNil() {
 		v = reflect.New(v.Type().Elem())
 	}
 
+	defer useTagOrder(c, to)()
 	m := v.Interface().(ByteCoder)
 	err := m.MarshalBytes(c)
 	if err != nil {
@@ -323,9 +520,9 @@ func (byteCoderCoder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
 	}
 }
 
-func (byteCoderCoder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (byteCoderCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	// 如果没有数据，不在检测空指针并初始化它
-	if c.Len() == 0 {
+	if !c.more() {
 		return
 	}
 
@@ -333,6 +530,7 @@ func (byteCoderCoder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
 		v.Set(reflect.New(v.Type().Elem()))
 	}
 
+	defer useTagOrder(c, to)()
 	m := v.Interface().(ByteCoder)
 	err := m.UnmarshalBytes(c)
 	if err != nil {
@@ -340,17 +538,29 @@ func (byteCoderCoder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
 	}
 }
 
+// useTagOrder 在调用自定义 ByteCoder 前设置字段标签指定的字节序，返回的函数用于恢复之前的设置
+// ByteCoder 中通过 ByteOrder 获取到的就是这个字节序
+func useTagOrder(c *CodecState, to tagOptions) func() {
+	prev, prevTag := c.order, c.tagOrder
+	if to.byteOrder != nil {
+		c.order = to.byteOrder
+	}
+	c.tagOrder = to.byteOrder != nil
+	return func() { c.order, c.tagOrder = prev, prevTag }
+}
+
 type addrByteCoderCoder struct{}
 
 func (addrByteCoderCoder) typ() reflect.Kind {
 	return reflect.Invalid
 }
 
-func (addrByteCoderCoder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (addrByteCoderCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 	va := v.Addr()
 	if va.IsNil() {
 		va = reflect.New(v.Type().Elem())
 	}
+	defer useTagOrder(c, to)()
 	m := va.Interface().(ByteCoder)
 	err := m.MarshalBytes(c)
 	if err != nil {
@@ -358,9 +568,9 @@ func (addrByteCoderCoder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
 	}
 }
 
-func (addrByteCoderCoder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (addrByteCoderCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	// 如果没有数据，不在检测空指针并初始化它
-	if c.Len() == 0 {
+	if !c.more() {
 		return
 	}
 
@@ -368,6 +578,7 @@ func (addrByteCoderCoder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
 	if va.IsNil() {
 		v.Set(reflect.New(v.Type().Elem()))
 	}
+	defer useTagOrder(c, to)()
 	m := va.Interface().(ByteCoder)
 	err := m.UnmarshalBytes(c)
 	if err != nil {
@@ -403,11 +614,17 @@ func (int8Coder) typ() reflect.Kind {
 	return reflect.Int8
 }
 
-func (int8Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int8Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	c.WriteByte(byte(v.Int()))
 }
 
-func (int8Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int8Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	v.SetInt(int64(int8(c.ReadByte())))
 }
 
@@ -417,17 +634,23 @@ func (int16Coder) typ() reflect.Kind {
 	return reflect.Int16
 }
 
-func (int16Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int16Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	i := v.Int()
-	b := make([]byte, 2)
-	binary.BigEndian.PutUint16(b, uint16(i))
+	b := c.scratch[:2]
+	c.byteOrder(to).PutUint16(b, uint16(i))
 	c.Write(b)
 }
 
-func (int16Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int16Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	b := make([]byte, 2)
 	c.ReadFull(b)
-	i := binary.BigEndian.Uint16(b)
+	i := c.byteOrder(to).Uint16(b)
 	v.SetInt(int64(int16(i)))
 }
 
@@ -437,17 +660,23 @@ func (int32Coder) typ() reflect.Kind {
 	return reflect.Int32
 }
 
-func (int32Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int32Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	i := v.Int()
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, uint32(i))
+	b := c.scratch[:4]
+	c.byteOrder(to).PutUint32(b, uint32(i))
 	c.Write(b)
 }
 
-func (int32Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int32Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	b := make([]byte, 4)
 	c.ReadFull(b)
-	i := binary.BigEndian.Uint32(b)
+	i := c.byteOrder(to).Uint32(b)
 	v.SetInt(int64(int32(i)))
 }
 
@@ -457,17 +686,23 @@ func (int64Coder) typ() reflect.Kind {
 	return reflect.Int64
 }
 
-func (int64Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int64Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	i := v.Int()
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, uint64(i))
+	b := c.scratch[:8]
+	c.byteOrder(to).PutUint64(b, uint64(i))
 	c.Write(b)
 }
 
-func (int64Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (int64Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	b := make([]byte, 8)
 	c.ReadFull(b)
-	i := binary.BigEndian.Uint64(b)
+	i := c.byteOrder(to).Uint64(b)
 	v.SetInt(int64(i))
 }
 
@@ -477,11 +712,17 @@ func (uint8Coder) typ() reflect.Kind {
 	return reflect.Uint8
 }
 
-func (uint8Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint8Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	c.WriteByte(byte(v.Uint()))
 }
 
-func (uint8Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint8Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	v.SetUint(uint64(c.ReadByte()))
 }
 
@@ -491,17 +732,23 @@ func (uint16Coder) typ() reflect.Kind {
 	return reflect.Uint16
 }
 
-func (uint16Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint16Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	u := v.Uint()
-	b := make([]byte, 2)
-	binary.BigEndian.PutUint16(b, uint16(u))
+	b := c.scratch[:2]
+	c.byteOrder(to).PutUint16(b, uint16(u))
 	c.Write(b)
 }
 
-func (uint16Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint16Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	b := make([]byte, 2)
 	c.ReadFull(b)
-	u := binary.BigEndian.Uint16(b)
+	u := c.byteOrder(to).Uint16(b)
 	v.SetUint(uint64(u))
 }
 
@@ -511,17 +758,23 @@ func (uint32Coder) typ() reflect.Kind {
 	return reflect.Uint32
 }
 
-func (uint32Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint32Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	u := v.Uint()
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, uint32(u))
+	b := c.scratch[:4]
+	c.byteOrder(to).PutUint32(b, uint32(u))
 	c.Write(b)
 }
 
-func (uint32Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint32Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	b := make([]byte, 4)
 	c.ReadFull(b)
-	u := binary.BigEndian.Uint32(b)
+	u := c.byteOrder(to).Uint32(b)
 	v.SetUint(uint64(u))
 }
 
@@ -531,17 +784,23 @@ func (uint64Coder) typ() reflect.Kind {
 	return reflect.Uint64
 }
 
-func (uint64Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint64Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	if encodeVarint(c, v, to) {
+		return
+	}
 	u := v.Uint()
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, u)
+	b := c.scratch[:8]
+	c.byteOrder(to).PutUint64(b, u)
 	c.Write(b)
 }
 
-func (uint64Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (uint64Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if decodeVarint(c, v, to) {
+		return
+	}
 	b := make([]byte, 8)
 	c.ReadFull(b)
-	u := binary.BigEndian.Uint64(b)
+	u := c.byteOrder(to).Uint64(b)
 	v.SetUint(u)
 }
 
@@ -551,22 +810,22 @@ func (float32Coder) typ() reflect.Kind {
 	return reflect.Float32
 }
 
-func (float32Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (float32Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 	f := v.Float()
 	if math.IsInf(f, 0) || math.IsNaN(f) {
 		c.error(&UnsupportedValueError{v, strconv.FormatFloat(f, 'g', -1, 32)})
 	}
 
 	u := math.Float32bits(float32(f))
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, u)
+	b := c.scratch[:4]
+	c.byteOrder(to).PutUint32(b, u)
 	c.Write(b)
 }
 
-func (float32Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (float32Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	b := make([]byte, 4)
 	c.ReadFull(b)
-	u := binary.BigEndian.Uint32(b)
+	u := c.byteOrder(to).Uint32(b)
 	f := math.Float32frombits(u)
 	v.SetFloat(float64(f))
 }
@@ -577,22 +836,22 @@ func (float64Coder) typ() reflect.Kind {
 	return reflect.Float64
 }
 
-func (float64Coder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (float64Coder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 	f := v.Float()
 	if math.IsInf(f, 0) || math.IsNaN(f) {
 		c.error(&UnsupportedValueError{v, strconv.FormatFloat(f, 'g', -1, 64)})
 	}
 
 	u := math.Float64bits(f)
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, u)
+	b := c.scratch[:8]
+	c.byteOrder(to).PutUint64(b, u)
 	c.Write(b)
 }
 
-func (float64Coder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+func (float64Coder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	b := make([]byte, 8)
 	c.ReadFull(b)
-	u := binary.BigEndian.Uint64(b)
+	u := c.byteOrder(to).Uint64(b)
 	f := math.Float64frombits(u)
 	v.SetFloat(f)
 }
@@ -640,59 +899,71 @@ func (stringCoder) typ() reflect.Kind {
 	return reflect.String
 }
 
-func (stringCoder) checklength(c *CodecState, taglengt, length int) {
-	if taglengt > 0 && length != taglengt {
-		c.error(&LengthErr{fmt.Errorf("string length %d tag length %d", length, taglengt)})
+func (stringCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	b := stringBytes(c, v.String(), to)
+	if to.prefix != nil {
+		writePrefix(c, to, len(b))
 	}
+	length, _ := c.Write(b)
 	c.set("length", length)
 }
 
-func (sc stringCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
-	str := v.String()
+func (stringCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	// string 的长度前缀总是字节数
+	if to.prefix != nil {
+		to.length = readPrefix(c, to, true)
+	}
+	if s, ok := decodeString(c, to); ok {
+		v.SetString(s)
+	}
+}
 
+// stringBytes 按照标签编码字符串，并检查编码后的字节长度和 length 标签是否一致，pad truncate 标签可以调整长度
+func stringBytes(c *CodecState, str string, to tagOptions) []byte {
+	checkStringTags(c, to)
+	b := []byte(str)
 	if to.bcd8421 != 0 {
-		b, err := bcd8421.EncodeFromStr(str, to.bcd8421)
+		bcd, err := bcd8421.EncodeFromStr(str, to.bcd8421)
 		if err != nil {
 			c.error(&EncodeBCDErr{err})
 		}
-		length, _ := c.Write(b)
-		sc.checklength(c, to.length, length)
-		return
-	}
-
-	var strCodeing encoding.Encoding
-	if to.gbk {
-		strCodeing = simplifiedchinese.GBK
-	}
-	if to.gbk18030 {
-		strCodeing = simplifiedchinese.GB18030
-	}
-	if strCodeing != nil {
-		b, err := strCodeing.NewEncoder().Bytes([]byte(str))
+		b = bcd
+	} else if strCodeing := stringEncoding(to); strCodeing != nil {
+		encoded, err := strCodeing.NewEncoder().Bytes(b)
 		if err != nil {
 			c.error(&EncodeGBKErr{err})
 		}
-		length, _ := c.Write(b)
-		sc.checklength(c, to.length, length)
-		return
+		b = encoded
 	}
-	length, _ := c.Write([]byte(str))
-	sc.checklength(c, to.length, length)
-	return
+
+	if to.bcd8421 != 0 {
+		if to.length > 0 && len(b) != to.length {
+			c.error(&LengthErr{fmt.Errorf("string length %d tag length %d", len(b), to.length)})
+		}
+		return b
+	}
+	if to.cstring {
+		return cstringBytes(c, b, str, to)
+	}
+	return fitString(c, b, str, to)
 }
 
-func (sc stringCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
-	if to.length == 0 {
-		return
+// decodeString 按照标签解码字符串，长度为 0 时不读取数据，返回的 ok 为 false
+// cstring 读取到结束符为止，不使用 length 标签和 lengthref 得到的长度
+func decodeString(c *CodecState, to tagOptions) (s string, ok bool) {
+	checkStringTags(c, to)
+	if to.length == 0 && !to.cstring {
+		return "", false
 	}
 
 	var b []byte
-	if to.length > 0 {
-		b = make([]byte, to.length)
-		c.ReadFull(b)
+	if to.cstring {
+		b = readCString(c, to)
+	} else if to.length > 0 {
+		b = c.readLimited(to.length)
 	} else {
-		b = make([]byte, c.Len())
-		c.ReadFull(b)
+		c.unbounded()
+		b = c.readRemaining()
 	}
 
 	if to.bcd8421 != 0 {
@@ -700,10 +971,21 @@ func (sc stringCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 		if err != nil {
 			c.error(&DecodeBCDErr{err})
 		}
-		v.SetString(string(sb))
-		return
+		return string(sb), true
+	}
+
+	b = trimPad(b, to)
+	if strCodeing := stringEncoding(to); strCodeing != nil {
+		sb, err := strCodeing.NewDecoder().Bytes(b)
+		if err != nil {
+			c.error(&DecodeGBKErr{err})
+		}
+		return string(sb), true
 	}
+	return string(b), true
+}
 
+func stringEncoding(to tagOptions) encoding.Encoding {
 	var strCodeing encoding.Encoding
 	if to.gbk {
 		strCodeing = simplifiedchinese.GBK
@@ -711,15 +993,7 @@ func (sc stringCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	if to.gbk18030 {
 		strCodeing = simplifiedchinese.GB18030
 	}
-	if strCodeing != nil {
-		sb, err := strCodeing.NewDecoder().Bytes(b)
-		if err != nil {
-			c.error(&DecodeGBKErr{err})
-		}
-		v.SetString(string(sb))
-		return
-	}
-	v.SetString(string(b))
+	return strCodeing
 }
 
 type interfaceCoder struct{}
@@ -774,7 +1048,10 @@ type field struct {
 }
 
 type structFields struct {
-	list []field
+	list      []field
+	byteOrder binary.ByteOrder // 结构体通过 _ 字段的标签声明的默认字节序
+	spans     bool             // 是否有字段使用了 lengthref:A..D 指向多个字段
+	cross     bool             // 是否有字段使用了 lengthref:Body.Payload 指向内层结构体的字段
 }
 
 type structCoder struct {
@@ -785,38 +1062,333 @@ func (structCoder) typ() reflect.Kind {
 	return reflect.Struct
 }
 
-func (sc structCoder) encode(c *CodecState, v reflect.Value, _ tagOptions) {
-	buf := make([][]byte, len(sc.fields.list))
+// useByteOrder 设置结构体字段使用的默认字节序，返回的函数用于恢复之前的设置
+// 字段标签指定的字节序优先于结构体自身声明的字节序
+func (sc structCoder) useByteOrder(c *CodecState, to tagOptions) func() {
+	order := to.byteOrder
+	if order == nil {
+		order = sc.fields.byteOrder
+	}
+	if order == nil {
+		return func() {}
+	}
+	prev := c.order
+	c.order = order
+	return func() { c.order = prev }
+}
+
+func (sc structCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	defer sc.useByteOrder(c, to)()
+	e := &structEncoder{sc: sc, c: c, v: v, cur: -1, depth: len(c.path)}
+	if n := len(sc.fields.list) + 1; n <= len(e.posBuf) {
+		e.pos = e.posBuf[:n]
+	} else {
+		e.pos = make([]int, n)
+	}
+	start := c.Len()
+	c.encoders = append(c.encoders, e)
+	defer func() {
+		c.encoders[len(c.encoders)-1] = nil
+		c.encoders = c.encoders[:len(c.encoders)-1]
+	}()
+	if pending := c.pendingRefs; pending != nil {
+		c.pendingRefs = nil
+		for _, p := range pending {
+			e.addRef(p.cr.owner.sc.fields.list[p.cr.index], p.path, p.cr)
+		}
+	}
 
 	for i := range sc.fields.list {
-		f := sc.fields.list[i]
-		fv := v.Field(f.index)
+		e.encodeField(i)
+		if sc.fields.spans {
+			e.endSpan(i)
+		}
+	}
+	e.bits.flush(c)
+	e.pos[len(sc.fields.list)] = c.Len()
+	sc.encodeChecksums(e)
+	if e.held() {
+		// 之后回填时 c.path 已经是其他字段的路径，保存 e 的路径用于 refError
+		e.path = append([]pathEntry(nil), c.path[:e.depth]...)
+		c.held = append(c.held, e)
+	}
+	if len(c.encoders) == 1 {
+		c.flushHeld()
+	}
+	c.set("length", c.Len()-start)
+}
 
-		if f.tagOptions.lengthref != "" {
-			found, ref, refindex := sc.findref(f)
-			if !found {
-				c.error(&TagErr{fmt.Errorf("lengthref %s not fount field %s", f.name, f.tagOptions.lengthref)})
-			}
+// structEncoder 保存一次结构体编码的状态，字段直接写入 c，不再为每个字段生成子 CodecState
+// lengthref 字段在指向的字段之前时先预留位置，指向的字段编码完成后回填长度
+// 校验字段同样先预留位置，在所有字段编码完成后回填
+type structEncoder struct {
+	sc   structCoder
+	c    *CodecState
+	v    reflect.Value
+	bits bitRun
+	pos  []int            // 字段在 c 中的起始位置，最后一个元素是结构体的结束位置
+	refs []lengthrefState // 以被 lengthref 指向的字段的下标为索引，需要时才分配
+	cur  int              // 正在编码的字段下标
 
-			refv := v.Field(ref.index)
-			err := sc.encodeLengthref(c, f, ref, i, refindex, refv, buf)
-			if err != nil {
-				c.error(err)
-			}
-			continue
+	depth int         // 开始编码时 c.path 的长度，c.path[:depth] 是这个结构体的路径
+	path  []pathEntry // 编码完成后保存的结构体路径，之后回填 lengthref 时使用
+
+	posBuf [16]int // 字段较少时 pos 使用的空间，避免再分配一次
+
+	deferred []checksumRange // 等待跨结构体 lengthref 回填后才能计算的校验字段
+
+	// 跨结构体的 lengthref，需要时才分配
+	cross map[int]*crossRef    // lengthref 字段下标 -> 这个字段的状态
+	watch map[int][]*crossRef  // 字段下标 -> 等待这个字段长度的 lengthref
+	down  map[int][]pendingRef // 字段下标 -> 交给这个内层结构体的 lengthref
+}
+
+// lengthrefState 是被 lengthref 指向的字段的编码状态
+type lengthrefState struct {
+	length     int    // 编码后的长度，string 为字节长度，slice、map 为元素个数，其他类型为字节长度
+	waiting    bool   // lengthref 字段已经预留了位置，等待回填
+	lengthref  int    // 等待回填的 lengthref 字段下标
+	preEncoded bool   // lengthref 字段不能预留固定宽度时，预先编码了这个字段
+	encoded    []byte // 预先编码的字节
+}
+
+func (e *structEncoder) refState(i int) *lengthrefState {
+	if e.refs == nil {
+		e.refs = make([]lengthrefState, len(e.sc.fields.list))
+	}
+	return &e.refs[i]
+}
+
+func (e *structEncoder) encodeField(i int) {
+	sc, c := e.sc, e.c
+	f := sc.fields.list[i]
+	fv := e.v.Field(f.index)
+	e.cur = i
+
+	if !sc.present(c, e.v, i) {
+		e.pos[i] = c.Len()
+		return
+	}
+	if f.tagOptions.bits == 0 {
+		e.bits.flush(c)
+	}
+	e.pos[i] = c.Len()
+	c.pushPath(f.name, fv.Type(), c.encodeOffset())
+	defer c.popPath()
+	if f.tagOptions.lengthErr != nil {
+		c.error(&TagErr{f.tagOptions.lengthErr})
+	}
+	if f.tagOptions.bitsErr != nil {
+		c.error(&TagErr{f.tagOptions.bitsErr})
+	}
+
+	if f.tagOptions.checksum != "" {
+		if width, ok := fixedWidth(f); ok {
+			c.Write(make([]byte, width))
 		}
-		if sc.existLengthref(f) {
-			continue
+		return
+	}
+	if f.tagOptions.lengthref != "" {
+		lengthv, ok := e.lengthref(i, f)
+		if !ok {
+			return
+		}
+		fv = lengthv
+	}
+	if dv, ok := sc.discriminator(c, e.v, i); ok {
+		fv = dv
+	}
+
+	if f.tagOptions.bits > 0 {
+		e.bits.encode(c, f, fv)
+		return
+	}
+
+	var ref *lengthrefState
+	referrer, referenced := sc.referrer(f)
+	if referenced && referrer.tagOptions.refSpanEnd == "" {
+		ref = e.refState(i)
+	}
+	if ref != nil && ref.preEncoded {
+		c.Write(ref.encoded)
+		return
+	}
+	watch := e.watch[i]
+	if ref != nil || watch != nil {
+		delete(c.v, "length")
+	}
+	c.pendingRefs = e.pendingRefs(i)
+	f.codec.encode(c, fv, f.tagOptions)
+	c.pendingRefs = nil
+	for _, cr := range watch {
+		lengthref := cr.owner.sc.fields.list[cr.index]
+		cr.deliver(refLength(c, lengthref, f, fv, c.Len()-e.pos[i]))
+	}
+	if ref != nil {
+		ref.length = refLength(c, referrer, f, fv, c.Len()-e.pos[i])
+		if ref.waiting {
+			e.patchLength(ref)
 		}
+	}
+}
 
+// lengthref 返回 lengthref 字段需要写入的值，指向的字段没有编码时为它预留位置，这时返回的 ok 为 false
+func (e *structEncoder) lengthref(i int, f field) (lengthv reflect.Value, ok bool) {
+	sc, c := e.sc, e.c
+	if f.tagOptions.refPath != nil {
+		if _, err := lengthValue(f, 0); err != nil {
+			c.error(err)
+		}
+		return e.crossLengthref(i, f)
+	}
+	found, ref, refindex := sc.findref(f)
+	if !found {
+		c.error(&TagErr{fmt.Errorf("lengthref %s not fount field %s", f.name, f.tagOptions.lengthref)})
+	}
+	if _, err := lengthValue(f, 0); err != nil {
+		c.error(err)
+	}
+	if f.tagOptions.refSpanEnd != "" {
+		return e.spanLengthref(i, f, refindex)
+	}
+
+	st := e.refState(refindex)
+	// 指向的字段在前面时已经编码，if 标签的条件不成立时长度为 0
+	if refindex > i && sc.present(c, e.v, refindex) {
+		width, fixed := fixedWidth(f)
+		if fixed && f.tagOptions.bits == 0 {
+			st.waiting = true
+			st.lengthref = i
+			c.Write(make([]byte, width))
+			return reflect.Value{}, false
+		}
+
+		// 变长编码和 bits 字段的宽度不固定，先编码指向的字段得到长度
 		scc := c.gensub()
-		f.codec.encode(scc, fv, f.tagOptions)
-		buf[i] = append([]byte(nil), scc.Bytes()...)
+		scc.base += c.Len()
+		ref.codec.encode(scc, e.v.Field(ref.index), ref.tagOptions)
+		st.encoded = append([]byte(nil), scc.Bytes()...)
+		st.length = refLength(scc, f, ref, e.v.Field(ref.index), scc.Len())
+		st.preEncoded = true
 		encodeStatePool.Put(scc)
 	}
-	structBytes := bytes.Join(buf, []byte{})
-	c.set("length", len(structBytes))
-	c.Write(structBytes)
+
+	lengthv, err := refValue(f, st.length)
+	if err != nil {
+		c.error(err)
+	}
+	return lengthv, true
+}
+
+// spanLengthref 返回 lengthref:A..D 字段需要写入的值，span 在后面时预留位置，span 编码完成后回填
+// 变长编码的 lengthref 字段不预留字节，回填时移动之后的字节
+func (e *structEncoder) spanLengthref(i int, f field, start int) (lengthv reflect.Value, ok bool) {
+	c := e.c
+	end := e.sc.spanEnd(c, f, start)
+	if i >= start && i <= end {
+		c.error(&TagErr{fmt.Errorf("lengthref %s is inside its span %s..%s", f.name, f.tagOptions.lengthref, f.tagOptions.refSpanEnd)})
+	}
+
+	st := e.refState(start)
+	if start > i {
+		if f.tagOptions.bits > 0 {
+			c.error(&TagErr{fmt.Errorf("lengthref %s bits field can not refer to a following span", f.name)})
+		}
+		width, _ := fixedWidth(f)
+		st.waiting = true
+		st.lengthref = i
+		c.Write(make([]byte, width))
+		return reflect.Value{}, false
+	}
+
+	lengthv, err := refValue(f, st.length)
+	if err != nil {
+		c.error(err)
+	}
+	return lengthv, true
+}
+
+// endSpan 在 span 的最后一个字段编码完成后记录 span 的字节数，lengthref 字段在前面时回填
+func (e *structEncoder) endSpan(i int) {
+	name := e.sc.fields.list[i].name
+	for _, f := range e.sc.fields.list {
+		if f.tagOptions.refSpanEnd != name {
+			continue
+		}
+		found, _, start := e.sc.findref(f)
+		if !found || start > i {
+			continue
+		}
+		st := e.refState(start)
+		st.length = e.c.Len() - e.pos[start]
+		if st.waiting {
+			st.waiting = false
+			e.patchLength(st)
+		}
+	}
+}
+
+func (e *structEncoder) patchLength(st *lengthrefState) {
+	e.patchRef(st.lengthref, st.length)
+}
+
+// patchRef 把长度回填到 lengthref 字段 i 预留的位置
+func (e *structEncoder) patchRef(i, length int) {
+	f := e.sc.fields.list[i]
+	lengthv, err := refValue(f, length)
+	if err != nil {
+		e.c.error(e.refError(i, err))
+	}
+	e.patch(i, func() { f.codec.encode(e.c, lengthv, f.tagOptions) })
+}
+
+// patch 把 encode 写入的字节回填到字段 i 预留的位置
+// 写入的字节数和预留的不一致时（例如变长编码的校验字段），移动之后的字节
+func (e *structEncoder) patch(i int, encode func()) {
+	c := e.c
+	pos, reserved := e.pos[i], e.pos[i+1]-e.pos[i]
+	n := c.Len()
+	encode()
+
+	b := c.Bytes()
+	value := b[n:]
+	if len(value) == reserved {
+		copy(b[pos:], value)
+		c.Truncate(n)
+		return
+	}
+	tail := append(append([]byte(nil), value...), b[pos+reserved:n]...)
+	c.Truncate(pos)
+	c.Write(tail)
+	for j := i + 1; j < len(e.pos); j++ {
+		e.pos[j] += len(value) - reserved
+	}
+	// 之后的字段中已经编码完成的结构体还在等待回填，它们的位置同样需要移动
+	for _, h := range c.held {
+		if h.pos[0] >= pos+reserved {
+			for j := range h.pos {
+				h.pos[j] += len(value) - reserved
+			}
+		}
+	}
+}
+
+// fixedWidth 返回字段编码后的固定字节数，变长编码和非数值类型返回的 ok 为 false
+func fixedWidth(f field) (width int, ok bool) {
+	if f.tagOptions.varint != varintNone {
+		return 0, false
+	}
+	switch f.codec.typ() {
+	case reflect.Int8, reflect.Uint8:
+		return 1, true
+	case reflect.Int16, reflect.Uint16:
+		return 2, true
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4, true
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr, reflect.Float64:
+		return 8, true
+	}
+	return 0, false
 }
 
 func (sc structCoder) findref(f field) (found bool, ref field, refindex int) {
@@ -830,106 +1402,338 @@ func (sc structCoder) findref(f field) (found bool, ref field, refindex int) {
 	return
 }
 
-func (sc structCoder) existLengthref(f field) bool {
+// spanEnd 返回 lengthref:A..D 中最后一个字段的下标
+func (sc structCoder) spanEnd(c *CodecState, f field, start int) int {
+	if f.tagOptions.refUnit == refCount {
+		c.error(&TagErr{fmt.Errorf("countref %s can not refer to a span", f.name)})
+	}
+	for i, item := range sc.fields.list {
+		if item.name == f.tagOptions.refSpanEnd {
+			if i < start {
+				break
+			}
+			return i
+		}
+	}
+	c.error(&TagErr{fmt.Errorf("lengthref %s invalid span %s..%s", f.name, f.tagOptions.lengthref, f.tagOptions.refSpanEnd)})
+	return -1
+}
+
+// referrer 返回通过 lengthref、sizeref、countref 指向字段 f 的字段
+func (sc structCoder) referrer(f field) (lengthref field, ok bool) {
 	for _, i := range sc.fields.list {
 		if f.name == i.tagOptions.lengthref {
-			return true
+			return i, true
 		}
 	}
-	return false
+	return field{}, false
+}
+
+// refLength 返回 lengthref 字段需要写入的长度，n 是指向的字段编码后的字节数
+// lengthref 使用 encodedLength，sizeref 总是字节数，countref 总是元素个数
+func refLength(c *CodecState, lengthref, target field, tv reflect.Value, n int) int {
+	switch lengthref.tagOptions.refUnit {
+	case refSize:
+		return n
+	case refCount:
+		checkCountref(c, lengthref, target)
+		for tv.Kind() == reflect.Ptr {
+			if tv.IsNil() {
+				return 0
+			}
+			tv = tv.Elem()
+		}
+		return tv.Len()
+	}
+	return encodedLength(c, n)
 }
 
-func (sc structCoder) encodeLengthref(c *CodecState, lengthref, ref field, lengthrefIndex, refIndex int, refv reflect.Value, buf [][]byte) error {
-	scc := c.gensub()
-	ref.codec.encode(scc, refv, ref.tagOptions)
-	refbytes := append([]byte(nil), scc.Bytes()...)
-	encodeStatePool.Put(scc)
-
-	length := scc.get("length").(int)
-	var lengthv reflect.Value
+// checkCountref 检查 countref 指向的字段是否有元素个数
+func checkCountref(c *CodecState, lengthref, target field) {
+	if k := elemKind(target.codec); k != reflect.Slice && k != reflect.Array && k != reflect.Map {
+		c.error(&TagErr{fmt.Errorf("countref %s field %s type %q has no elements", lengthref.name, target.name, k)})
+	}
+}
 
+// lengthValue 把长度转换为 lengthref 字段的类型
+func lengthValue(lengthref field, length int) (reflect.Value, error) {
+	if width, signed, ok := intWidth(lengthref); ok && !lengthref.tagOptions.wrap && overflowsInt(int64(length), width, signed) {
+		return reflect.Value{}, &OverflowError{Field: lengthref.name, Width: width, Value: int64(length)}
+	}
 	switch lengthref.codec.typ() {
 	case reflect.Int8:
-		lengthv = reflect.ValueOf(int8(length))
+		return reflect.ValueOf(int8(length)), nil
 	case reflect.Int16:
-		lengthv = reflect.ValueOf(int16(length))
+		return reflect.ValueOf(int16(length)), nil
 	case reflect.Int32:
-		lengthv = reflect.ValueOf(int32(length))
+		return reflect.ValueOf(int32(length)), nil
 	case reflect.Int, reflect.Int64:
-		lengthv = reflect.ValueOf(int64(length))
+		return reflect.ValueOf(int64(length)), nil
 	case reflect.Uint8:
-		lengthv = reflect.ValueOf(uint8(length))
+		return reflect.ValueOf(uint8(length)), nil
 	case reflect.Uint16:
-		lengthv = reflect.ValueOf(uint16(length))
+		return reflect.ValueOf(uint16(length)), nil
 	case reflect.Uint32:
-		lengthv = reflect.ValueOf(uint32(length))
+		return reflect.ValueOf(uint32(length)), nil
 	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
-		lengthv = reflect.ValueOf(uint64(length))
+		return reflect.ValueOf(uint64(length)), nil
 	case reflect.Float32:
-		lengthv = reflect.ValueOf(float32(length))
+		return reflect.ValueOf(float32(length)), nil
 	case reflect.Float64:
-		lengthv = reflect.ValueOf(float64(length))
-	default:
-		return &TagErr{fmt.Errorf("lengthref %s type %q is invalid", lengthref.name, lengthref.codec.typ())}
+		return reflect.ValueOf(float64(length)), nil
 	}
+	return reflect.Value{}, &TagErr{fmt.Errorf("lengthref %s type %q is invalid", lengthref.name, lengthref.codec.typ())}
+}
 
-	scc = c.gensub()
-	lengthref.codec.encode(scc, lengthv, lengthref.tagOptions)
-	lengthrefbytes := append([]byte(nil), scc.Bytes()...)
-	encodeStatePool.Put(scc)
+func (sc structCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	defer sc.useByteOrder(c, to)()
+	frame := c.pushFrame(sc)
+	defer c.popFrame()
+	if pending := c.pendingLengths; pending != nil {
+		c.pendingLengths = nil
+		for _, p := range pending {
+			frame.addLength(c, p.lengthref, p.path, p.length)
+		}
+	}
 
-	buf[lengthrefIndex] = lengthrefbytes
-	buf[refIndex] = refbytes
-	return nil
-}
+	checksums := sc.checksumRanges(c)
+	recs := make([]*bytes.Buffer, len(checksums))
 
-func (sc structCoder) decode(c *CodecState, v reflect.Value, _ tagOptions) {
+	for i := 0; i < len(sc.fields.list); i++ {
+		// lengthref:A..D 指向的多个字段一起解码，校验范围的起止字段在 span 内部时按照整个 span 计算
+		end, span := i, false
+		if sc.fields.spans {
+			if lengthref, ok := sc.referrer(sc.fields.list[i]); ok && lengthref.tagOptions.refSpanEnd != "" {
+				end, span = sc.spanEnd(c, lengthref, i), true
+			}
+		}
+		for j, cr := range checksums {
+			if cr.from >= i && cr.from <= end {
+				recs[j] = c.startRecord()
+			}
+		}
+		if span {
+			sc.decodeSpan(c, frame, i, end, v)
+		} else {
+			sc.decodeField(c, frame, i, v)
+		}
+		for j, cr := range checksums {
+			if cr.to >= i && cr.to <= end {
+				c.stopRecord(recs[j])
+			}
+		}
+		i = end
+	}
+	sc.verifyChecksums(c, v, checksums, recs)
+}
 
-	for i := range sc.fields.list {
-		f := sc.fields.list[i]
-		fv := v.Field(f.index)
+func (sc structCoder) decodeField(c *CodecState, frame *decodeFrame, i int, v reflect.Value) {
+	f := sc.fields.list[i]
+	fv := v.Field(f.index)
+	frame.cur = i
 
-		if f.tagOptions.bcd8421 != 0 {
-			f.tagOptions.length = f.tagOptions.bcd8421
+	if !sc.present(c, v, i) {
+		return
+	}
+	if f.tagOptions.bits == 0 {
+		frame.bits = nil
+	}
+	c.pushPath(f.name, fv.Type(), c.decodeOffset())
+	defer c.popPath()
+	if f.tagOptions.lengthErr != nil {
+		c.error(&TagErr{f.tagOptions.lengthErr})
+	}
+	if f.tagOptions.bitsErr != nil {
+		c.error(&TagErr{f.tagOptions.bitsErr})
+	}
+	if f.tagOptions.union != "" {
+		variant, isPtr := sc.newVariant(c, v, i)
+		fv.Set(variant)
+		if !isPtr {
+			defer func() { fv.Set(variant.Elem()) }()
 		}
+	}
+	if f.tagOptions.bcd8421 != 0 {
+		f.tagOptions.length = f.tagOptions.bcd8421
+	}
 
-		if f.tagOptions.lengthref != "" {
+	if f.tagOptions.lengthref != "" {
 
-			found, _, refindex := sc.findref(f)
+		refindex := -1
+		if f.tagOptions.refPath == nil {
+			var found bool
+			found, _, refindex = sc.findref(f)
 			if !found {
 				c.error(&TagErr{fmt.Errorf("lengthref %s not fount field %s", f.name, f.tagOptions.lengthref)})
 			}
-			f.codec.decode(c, fv, f.tagOptions)
-
-			var length int
-			switch f.codec.typ() {
-			case reflect.Int8:
-				fallthrough
-			case reflect.Int16:
-				fallthrough
-			case reflect.Int32:
-				fallthrough
-			case reflect.Int, reflect.Int64:
-				length = int(fv.Int())
-			case reflect.Uint8:
-				fallthrough
-			case reflect.Uint16:
-				fallthrough
-			case reflect.Uint32:
-				fallthrough
-			case reflect.Uint, reflect.Uint64, reflect.Uintptr:
-				length = int(fv.Uint())
-			case reflect.Float32:
-				fallthrough
-			case reflect.Float64:
-				length = int(fv.Float())
-			default:
-				c.error(&TagErr{fmt.Errorf("lengthref %s type %q is invalid", f.name, f.codec.typ())})
+		}
+		sc.decodeValue(c, frame, f, fv)
+
+		var length int
+		switch f.codec.typ() {
+		case reflect.Int8:
+			fallthrough
+		case reflect.Int16:
+			fallthrough
+		case reflect.Int32:
+			fallthrough
+		case reflect.Int, reflect.Int64:
+			length = c.RefLength(f.name, fv.Int())
+		case reflect.Uint8:
+			fallthrough
+		case reflect.Uint16:
+			fallthrough
+		case reflect.Uint32:
+			fallthrough
+		case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+			length = c.RefLengthUint(f.name, fv.Uint())
+		case reflect.Float32:
+			fallthrough
+		case reflect.Float64:
+			length = c.RefLengthFloat(f.name, fv.Float())
+		default:
+			c.error(&TagErr{fmt.Errorf("lengthref %s type %q is invalid", f.name, f.codec.typ())})
+		}
+		if refindex < 0 {
+			sc.setCrossLength(c, f, unscaledLength(c, f, length))
+			return
+		}
+		frame.setLength(refindex, unscaledLength(c, f, length))
+		return
+	}
+	if pending := frame.pending[i]; pending != nil {
+		c.pendingLengths = pending
+		defer func() { c.pendingLengths = nil }()
+	}
+	if length, ok := frame.lengths[i]; ok {
+		sc.decodeRef(c, frame, i, f, fv, length)
+		return
+	}
+	sc.decodeValue(c, frame, f, fv)
+}
+
+// decodeSpan 解码字段 start 到 end，lengthref:A..D 在前面时，在它得到的字节数范围内解码这些字段
+func (sc structCoder) decodeSpan(c *CodecState, frame *decodeFrame, start, end int, v reflect.Value) {
+	length, ok := frame.lengths[start]
+	if lengthref, _ := sc.referrer(sc.fields.list[start]); !ok || lengthref.tagOptions.refSpanEnd == "" {
+		for i := start; i <= end; i++ {
+			sc.decodeField(c, frame, i, v)
+		}
+		return
+	}
+
+	b := c.readLimited(length)
+	scc := c.gensub()
+	scc.base -= length
+	scc.Write(b)
+	frame.bits = nil
+	decodeWithin(c, scc, func() {
+		for i := start; i <= end; i++ {
+			sc.decodeField(scc, frame, i, v)
+		}
+	})
+	frame.bits = nil
+	encodeStatePool.Put(scc)
+}
+
+// decodeRef 使用 lengthref、sizeref、countref 得到的长度解码字段
+// sizeref 表示字节数，在这个范围内解码字段，slice、map 会一直读取元素直到用完这些字节
+func (sc structCoder) decodeRef(c *CodecState, frame *decodeFrame, i int, f field, fv reflect.Value, length int) {
+	lengthref, ok := frame.refs[i]
+	if !ok {
+		lengthref, _ = sc.referrer(f)
+	}
+	if lengthref.tagOptions.refSpanEnd != "" {
+		// 整个 span 已经在 decodeSpan 中限定了范围
+		sc.decodeValue(c, frame, f, fv)
+		return
+	}
+	switch lengthref.tagOptions.refUnit {
+	case refSize:
+		// 字节数来自输入，decodeLimited 在分配空间前检查剩余的数据
+		f.tagOptions.length = -1
+		decodeLimited(c, length, f.codec, fv, f.tagOptions)
+		return
+	case refCount:
+		// 元素个数同样来自输入，slice、map 随着解码的元素增长，不按照元素个数预先分配
+		checkCountref(c, lengthref, f)
+	}
+
+	f.tagOptions.length = length
+	if !handlesLength(f.codec) {
+		decodeBounded(c, f.codec, fv, f.tagOptions)
+		return
+	}
+	sc.decodeValue(c, frame, f, fv)
+}
+
+func (sc structCoder) decodeValue(c *CodecState, frame *decodeFrame, f field, fv reflect.Value) {
+	if f.tagOptions.bits > 0 {
+		decodeBits(c, frame, f, fv)
+		return
+	}
+	f.codec.decode(c, fv, f.tagOptions)
+}
+
+// decodeBounded 先读取 lengthref 指定长度的字节，再从这些字节中解码字段
+// 这样字段内读取全部剩余字节的操作不会越过 lengthref 限定的范围，流式解码时也不会多读
+// 结构体、自定义 ByteCoder 等类型没有正好读取这些字节时返回 BoundsError
+func decodeBounded(c *CodecState, cd codec, v reflect.Value, to tagOptions) {
+	decodeLimited(c, to.length, cd, v, to)
+}
+
+// decodeLimited 读取 n 个字节，再从这些字节中解码 v
+func decodeLimited(c *CodecState, n int, cd codec, v reflect.Value, to tagOptions) {
+	b := c.readLimited(n)
+
+	scc := c.gensub()
+	scc.base -= len(b)
+	scc.Write(b)
+	decodeWithin(c, scc, func() { cd.decode(scc, v, to) })
+	encodeStatePool.Put(scc)
+}
+
+// decodeWithin 在只包含限定范围内字节的 scc 中解码，字段需要正好读取这些字节
+// 读取超出范围或者没有读完时，在 c 中返回 BoundsError，读取超出范围时保留内层字段的路径和位置
+func decodeWithin(c, scc *CodecState, decode func()) {
+	n := scc.Len()
+	defer func() {
+		if r := recover(); r != nil {
+			var bounds *BoundsError
+			if be, ok := r.(bytecodecError); ok && errors.Is(be.error, ErrShortData) && !errors.As(be.error, &bounds) {
+				if fe, ok := be.error.(*FieldError); ok {
+					c.error(&FieldError{Path: fe.Path, Type: fe.Type, Offset: fe.Offset, Err: &BoundsError{Length: n, Read: -1}})
+				}
+				c.error(&BoundsError{Length: n, Read: -1})
 			}
-			sc.fields.list[refindex].tagOptions.length = length
-			continue
+			panic(r)
+		}
+	}()
+	decode()
+	if scc.Len() > 0 {
+		c.error(&BoundsError{Length: n, Read: n - scc.Len()})
+	}
+}
+
+// handlesLength 返回这个编码器是否自己处理 lengthref 得到的长度，string 的字节长度或 slice、array、map 的元素个数
+// 这些类型自己处理长度，其他类型的 lengthref 表示字节长度，需要限定解码范围
+func handlesLength(cd codec) bool {
+	k := elemKind(cd)
+	return k == reflect.String || k == reflect.Slice || k == reflect.Array || k == reflect.Map
+}
+
+// elemKind 返回编码器处理的类型，指针返回指向的类型
+func elemKind(cd codec) reflect.Kind {
+	for {
+		switch ec := cd.(type) {
+		case ptrCoder:
+			cd = ec.elemCodec
+		case recursiveWrapCoder:
+			ec.wg.Wait()
+			cd = *ec.elemCodec
+		default:
+			return cd.typ()
 		}
-		f.codec.decode(c, fv, f.tagOptions)
 	}
 }
 
@@ -954,14 +1758,8 @@ func (ac arrayCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 
 func (ac arrayCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	i := 0
-	for {
-		if i < v.Len() {
-			ac.elemCodec.decode(c, v.Index(i), to)
-			if c.Len() == 0 {
-				break
-			}
-		}
-		i++
+	for ; i < v.Len() && c.more(); i++ {
+		ac.elemCodec.decode(c, v.Index(i), to)
 	}
 
 	if i < v.Len() {
@@ -986,6 +1784,10 @@ func (sliceCoder) typ() reflect.Kind {
 
 func (sc sliceCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 	n := v.Len()
+	if to.prefix != nil {
+		sc.encodePrefixed(c, v, to)
+		return
+	}
 
 	for i := 0; i < n; i++ {
 		sc.elemCodec.encode(c, v.Index(i), to)
@@ -998,8 +1800,15 @@ func (sc sliceCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 }
 
 func (sc sliceCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	if to.prefix != nil {
+		sc.decodePrefixed(c, v, to)
+		return
+	}
+	if to.length < 0 {
+		c.unbounded()
+	}
 	i := 0
-	for ; (to.length < 0 || i < to.length) && c.Len() != 0; i++ {
+	for ; (to.length < 0 || i < to.length) && c.more(); i++ {
 		// Grow slice if necessary
 		if i >= v.Cap() {
 			newcap := v.Cap() + v.Cap()/2
@@ -1022,6 +1831,44 @@ func (sc sliceCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	}
 }
 
+// encodePrefixed 写入 prefix 标签指定的长度前缀和元素，长度前缀默认为元素个数，使用 bytes 选项时为元素编码后的字节数
+func (sc sliceCoder) encodePrefixed(c *CodecState, v reflect.Value, to tagOptions) {
+	n := v.Len()
+	elemTo := to.withoutPrefix()
+	if to.prefix.unit != prefixBytes {
+		writePrefix(c, to, n)
+		for i := 0; i < n; i++ {
+			sc.elemCodec.encode(c, v.Index(i), elemTo)
+		}
+		c.set("length", n)
+		return
+	}
+
+	scc := c.gensub()
+	scc.base += c.Len()
+	for i := 0; i < n; i++ {
+		sc.elemCodec.encode(scc, v.Index(i), elemTo)
+	}
+	writePrefix(c, to, scc.Len())
+	c.Write(scc.Bytes())
+	encodeStatePool.Put(scc)
+	c.set("length", n)
+}
+
+// decodePrefixed 读取长度前缀，再按照元素个数或者在前缀限定的字节范围内解码元素
+func (sc sliceCoder) decodePrefixed(c *CodecState, v reflect.Value, to tagOptions) {
+	elemTo := to.withoutPrefix()
+	if to.prefix.unit != prefixBytes {
+		elemTo.length = readPrefix(c, to, false)
+		sc.decode(c, v, elemTo)
+		return
+	}
+
+	n := readPrefix(c, to, true)
+	elemTo.length = -1
+	decodeLimited(c, n, sc, v, elemTo)
+}
+
 func newSliceCoder(t reflect.Type) codec {
 	return sliceCoder{typeCodec(t.Elem())}
 }
@@ -1061,7 +1908,7 @@ func (pe ptrCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 
 func (pe ptrCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
 	// 如果没有数据，不在检测空指针并初始化它
-	if c.Len() == 0 {
+	if !c.more() {
 		return
 	}
 	if v.IsNil() {
@@ -1120,6 +1967,7 @@ func (ce condAddrCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
 			if v.Kind() == reflect.Ptr && v.IsNil() {
 				v = reflect.New(v.Type().Elem())
 			}
+			defer useTagOrder(c, to)()
 			m := v.Interface().(marshaler)
 			err := m.MarshalBytes(c)
 			if err != nil {
@@ -1149,8 +1997,16 @@ func newCondAddrCoder(canAddrC, elseC codec) codec {
 
 func typeFields(t reflect.Type) structFields {
 	var fields []field
+	var order binary.ByteOrder
 	for i := 0; i < t.NumField(); i++ {
 		sf := t.Field(i)
+		if sf.Name == "_" {
+			// 没有 le、be 标签的 _ 字段不会覆盖之前声明的字节序
+			if o := parseTag(sf.Tag.Get("bytecodec")).byteOrder; o != nil {
+				order = o
+			}
+			continue
+		}
 		isUnexported := sf.PkgPath != ""
 		if isUnexported || sf.Anonymous {
 			continue
@@ -1169,7 +2025,17 @@ func typeFields(t reflect.Type) structFields {
 		}
 		fields = append(fields, field)
 	}
-	return structFields{fields}
+	resolveLengthExprs(fields)
+	spans, cross := false, false
+	for _, f := range fields {
+		if f.tagOptions.refSpanEnd != "" {
+			spans = true
+		}
+		if p := f.tagOptions.refPath; p != nil && p.up == 0 {
+			cross = true
+		}
+	}
+	return structFields{fields, order, spans, cross}
 }
 
 var fieldCache sync.Map // map[reflect.Type]structFields
@@ -1,9 +1,14 @@
 package bytecodec
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -104,9 +109,9 @@ var allValue = All{
 	EmptySliceLength: 0,
 	Int16SliceLength: 2,
 	ByteSliceLength:  3,
-	SmallLength: 5,
-	PSmallLength: 5,
-	PPSmallLength: 5,
+	SmallLength:      5,
+	PSmallLength:     5,
+	PPSmallLength:    5,
 
 	String:     "16",
 	Slice:      []Small{{Tag: "tag20"}, {Tag: "tag21"}},
@@ -403,6 +408,782 @@ func TestStringTag(t *testing.T) {
 	testMarshalUnmarshal(t, stringTagTests)
 }
 
+type padTag struct {
+	Space string `bytecodec:"length:4;pad:space"`
+	Nul   string `bytecodec:"length:4;pad:nul"`
+	Left  string `bytecodec:"length:4;pad:nul,left"`
+	GBK   string `bytecodec:"gbk;length:6;pad:space"`
+	Trunc string `bytecodec:"length:3;pad:space;truncate"`
+}
+
+var padTagTests = []testcase{{
+	[]byte{
+		0x61, 0x62, 0x20, 0x20,
+		0x61, 0x0, 0x0, 0x0,
+		0x0, 0x0, 0x0, 0x61,
+		0xb2, 0xe2, 0xca, 0xd4, 0x20, 0x20,
+		0x61, 0x62, 0x63,
+	},
+	&padTag{},
+	&padTag{"ab", "a", "a", "测试", "abc"},
+}, {
+	[]byte{
+		0x20, 0x20, 0x20, 0x20,
+		0x0, 0x0, 0x0, 0x0,
+		0x0, 0x0, 0x0, 0x0,
+		0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+		0x20, 0x20, 0x20,
+	},
+	&padTag{},
+	&padTag{},
+}}
+
+func TestPadTag(t *testing.T) {
+	testMarshalUnmarshal(t, padTagTests)
+
+	values := []interface{}{
+		&struct {
+			S string `bytecodec:"length:4;pad:zero"`
+		}{},
+		&struct {
+			S string `bytecodec:"length:4;pad:space,middle"`
+		}{},
+		&struct {
+			M map[string]uint8 `bytecodec:"key.length:4;key.pad:nul,top"`
+		}{M: map[string]uint8{"a": 1}},
+	}
+	for _, v := range values {
+		var te *TagErr
+		if _, err := Marshal(v); !errors.As(err, &te) {
+			t.Errorf("Marshal %#v got error %v, want TagErr", v, err)
+		}
+		if err := Unmarshal([]byte{0x61, 0x62, 0x63, 0x64, 0x1}, v); !errors.As(err, &te) {
+			t.Errorf("Unmarshal %#v got error %v, want TagErr", v, err)
+		}
+	}
+}
+
+type cstringTag struct {
+	Name  string   `bytecodec:"cstring"`
+	GBK   string   `bytecodec:"cstring:5;gbk"`
+	Trunc string   `bytecodec:"cstring:4;truncate"`
+	Empty string   `bytecodec:"cstring"`
+	Count uint8    `bytecodec:"lengthref:List"`
+	List  []string `bytecodec:"cstring;gbk18030"`
+	Tail  []string `bytecodec:"cstring"`
+}
+
+var cstringTagTests = []testcase{{
+	[]byte{
+		0x61, 0x62, 0x0,
+		0xb2, 0xe2, 0xca, 0xd4, 0x0,
+		0x61, 0x62, 0x63, 0x0,
+		0x0,
+		0x2,
+		0xb2, 0xe2, 0x0, 0x0,
+		0x78, 0x0, 0x79, 0x0,
+	},
+	&cstringTag{},
+	&cstringTag{"ab", "测试", "abc", "", 2, []string{"测", ""}, []string{"x", "y"}},
+}}
+
+func TestCStringTag(t *testing.T) {
+	testMarshalUnmarshal(t, cstringTagTests)
+
+	b, err := Marshal(cstringTag{Trunc: "abcdef", List: []string{}})
+	want := []byte{0x0, 0x0, 0x61, 0x62, 0x63, 0x0, 0x0, 0x0}
+	if err != nil || !reflect.DeepEqual(b, want) {
+		t.Errorf("Marshal truncate = %#v, %v, want %#v", b, err, want)
+	}
+
+	var le *LengthErr
+	if _, err := Marshal(cstringTag{GBK: "测试一"}); !errors.As(err, &le) {
+		t.Errorf("Marshal too long got error %v, want LengthErr", err)
+	}
+	var uve *UnsupportedValueError
+	if _, err := Marshal(cstringTag{Name: "a\x00b"}); !errors.As(err, &uve) {
+		t.Errorf("Marshal NUL got error %v, want UnsupportedValueError", err)
+	}
+	if err := Unmarshal([]byte{0x61, 0x0, 0xb2, 0xe2, 0xca, 0xd4, 0x61, 0x0}, &cstringTag{}); !errors.As(err, &le) {
+		t.Errorf("Unmarshal too long got error %v, want LengthErr", err)
+	}
+	if err := Unmarshal([]byte{0x61, 0x62}, &cstringTag{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Unmarshal missing NUL got error %v, want ErrShortData", err)
+	}
+
+	for _, v := range []interface{}{
+		&struct {
+			S string `bytecodec:"cstring:abc"`
+		}{},
+		&struct {
+			S string `bytecodec:"cstring:0"`
+		}{},
+	} {
+		var te *TagErr
+		if _, err := Marshal(v); !errors.As(err, &te) {
+			t.Errorf("Marshal %#v got error %v, want TagErr", v, err)
+		}
+		if err := Unmarshal([]byte{0x61, 0x0}, v); !errors.As(err, &te) {
+			t.Errorf("Unmarshal %#v got error %v, want TagErr", v, err)
+		}
+	}
+}
+
+type prefixItem struct {
+	ID   uint16
+	Name string `bytecodec:"prefix:uint8"`
+}
+
+type prefixTag struct {
+	Str    string       `bytecodec:"prefix:uint8"`
+	GBK    string       `bytecodec:"prefix:uint16;gbk;le"`
+	Var    string       `bytecodec:"prefix:uvarint"`
+	Empty  string       `bytecodec:"prefix:varint"`
+	Count  []uint16     `bytecodec:"prefix:uint16"`
+	Bytes  []uint16     `bytecodec:"prefix:uint8,bytes"`
+	Items  []prefixItem `bytecodec:"prefix:mqttvarint,bytes"`
+	Counts []prefixItem `bytecodec:"prefix:uint32,count"`
+}
+
+var prefixTagTests = []testcase{{
+	[]byte{
+		0x2, 0x61, 0x62,
+		0x4, 0x0, 0xb2, 0xe2, 0xca, 0xd4,
+		0x1, 0x63,
+		0x0,
+		0x0, 0x2, 0x0, 0x1, 0x0, 0x2,
+		0x4, 0x0, 0x3, 0x0, 0x4,
+		0x8, 0x0, 0x1, 0x1, 0x61, 0x0, 0x2, 0x1, 0x62,
+		0x0, 0x0, 0x0, 0x1, 0x0, 0x3, 0x0,
+	},
+	&prefixTag{},
+	&prefixTag{
+		"ab", "测试", "c", "",
+		[]uint16{1, 2}, []uint16{3, 4},
+		[]prefixItem{{1, "a"}, {2, "b"}},
+		[]prefixItem{{3, ""}},
+	},
+}}
+
+func TestPrefixTag(t *testing.T) {
+	testMarshalUnmarshal(t, prefixTagTests)
+
+	var oe *OverflowError
+	if _, err := Marshal(prefixItem{Name: strings.Repeat("a", 256)}); !errors.As(err, &oe) || oe.Width != 8 {
+		t.Errorf("Marshal overflow got error %v, want OverflowError", err)
+	}
+	if err := Unmarshal([]byte{0x0, 0x1, 0x3, 0x61}, &prefixItem{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Unmarshal short data got error %v, want ErrShortData", err)
+	}
+	var te *TagErr
+	if _, err := Marshal(struct {
+		S string `bytecodec:"prefix:int8"`
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal invalid prefix got error %v, want TagErr", err)
+	}
+}
+
+type sizeCountRef struct {
+	ItemSize uint8 `bytecodec:"sizeref:List"`
+	List     []prefixItem
+	NumIDs   uint8 `bytecodec:"countref:IDs"`
+	IDs      []uint16
+	StrSize  uint8  `bytecodec:"sizeref:Str"`
+	Str      string `bytecodec:"gbk"`
+	Tail     uint8
+}
+
+var sizeCountRefTests = []testcase{{
+	[]byte{
+		0x8, 0x0, 0x1, 0x1, 0x61, 0x0, 0x2, 0x1, 0x62,
+		0x2, 0x0, 0x3, 0x0, 0x4,
+		0x4, 0xb2, 0xe2, 0xca, 0xd4,
+		0xff,
+	},
+	&sizeCountRef{},
+	&sizeCountRef{
+		ItemSize: 8, List: []prefixItem{{1, "a"}, {2, "b"}},
+		NumIDs: 2, IDs: []uint16{3, 4},
+		StrSize: 4, Str: "测试",
+		Tail: 0xff,
+	},
+}}
+
+type countMap struct {
+	Count uint8            `bytecodec:"countref:Attrs"`
+	Attrs map[uint8]string `bytecodec:"value.prefix:uint8"`
+	Size  uint8            `bytecodec:"sizeref:Pairs"`
+	Pairs map[uint8]uint16
+}
+
+var countMapTests = []testcase{{
+	[]byte{
+		0x2, 0x1, 0x1, 0x61, 0x2, 0x0,
+		0x6, 0x1, 0x0, 0x1, 0x2, 0x0, 0x2,
+	},
+	&countMap{},
+	&countMap{2, map[uint8]string{1: "a", 2: ""}, 6, map[uint8]uint16{1: 1, 2: 2}},
+}}
+
+func TestSizeCountRef(t *testing.T) {
+	testMarshalUnmarshal(t, sizeCountRefTests)
+	testMarshalUnmarshal(t, countMapTests)
+
+	var te *TagErr
+	if _, err := Marshal(struct {
+		N uint8 `bytecodec:"countref:S"`
+		S string
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal countref string got error %v, want TagErr", err)
+	}
+
+	// sizeref 的字节数远远超过剩余的数据时返回 ErrShortData，不会按照这个长度分配空间
+	if err := Unmarshal([]byte{0x40, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1}, &struct {
+		N   uint64 `bytecodec:"sizeref:IDs"`
+		IDs []uint16
+	}{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Unmarshal huge sizeref got error %v, want ErrShortData", err)
+	}
+	// countref 的元素个数来自输入，slice 随着解码的元素增长，不会按照元素个数预先分配
+	var huge struct {
+		N   uint32 `bytecodec:"countref:IDs"`
+		IDs []uint16
+	}
+	if err := Unmarshal([]byte{0xff, 0xff, 0xff, 0xff, 0x0, 0x1, 0x0, 0x2}, &huge); err != nil || !reflect.DeepEqual(huge.IDs, []uint16{1, 2}) || cap(huge.IDs) > 4 {
+		t.Errorf("Unmarshal huge countref = %v cap %d, %v", huge.IDs, cap(huge.IDs), err)
+	}
+
+	conflict := struct {
+		N uint8 `bytecodec:"lengthref:S;sizeref:S"`
+		S []uint16
+	}{S: []uint16{1}}
+	if _, err := Marshal(&conflict); !errors.As(err, &te) || !strings.Contains(err.Error(), "lengthref, sizeref") {
+		t.Errorf("Marshal lengthref and sizeref got error %v, want TagErr", err)
+	}
+	if err := Unmarshal([]byte{0x2, 0x0, 0x1}, &conflict); !errors.As(err, &te) {
+		t.Errorf("Unmarshal lengthref and sizeref got error %v, want TagErr", err)
+	}
+}
+
+// lengthExprHeader 和 IPv4 首部类似，IHL 是包括选项在内的首部长度，单位为 4 字节
+type lengthExprHeader struct {
+	IHL      uint8 `bytecodec:"lengthref:Options,scale:4,adjust:+8"`
+	Flags    uint8
+	TotalLen uint16 `bytecodec:"be"`
+	Seq      [4]byte
+	Options  []byte
+	Words    uint8 `bytecodec:"countref:IDs;scale:2;adjust:-1"`
+	IDs      []uint16
+	Payload  string `bytecodec:"length:TotalLen-12"`
+}
+
+var lengthExprTests = []testcase{{
+	[]byte{
+		0x3,
+		0x1,
+		0x0, 0xe,
+		0x1, 0x2, 0x3, 0x4,
+		0xa, 0xb, 0xc, 0xd,
+		0x1,
+		0x0, 0x5, 0x0, 0x6, 0x0, 0x7,
+		0x61, 0x62,
+	},
+	&lengthExprHeader{},
+	&lengthExprHeader{
+		IHL: 3, Flags: 1, TotalLen: 14,
+		Seq:     [4]byte{1, 2, 3, 4},
+		Options: []byte{0xa, 0xb, 0xc, 0xd},
+		Words:   1, IDs: []uint16{5, 6, 7},
+		Payload: "ab",
+	},
+}}
+
+func TestLengthExpr(t *testing.T) {
+	testMarshalUnmarshal(t, lengthExprTests)
+
+	var le *LengthErr
+	if _, err := Marshal(lengthExprHeader{Options: []byte{1}}); !errors.As(err, &le) {
+		t.Errorf("Marshal not multiple of scale got error %v, want LengthErr", err)
+	}
+	b := []byte{0x1, 0x0, 0x0, 0x0}
+	if err := Unmarshal(b, &lengthExprHeader{}); !errors.As(err, &le) {
+		t.Errorf("Unmarshal negative length got error %v, want LengthErr", err)
+	}
+
+	var te *TagErr
+	if _, err := Marshal(struct {
+		S string `bytecodec:"length:Missing-2"`
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal missing field got error %v, want TagErr", err)
+	}
+	if _, err := Marshal(struct {
+		N uint8 `bytecodec:"lengthref:S,scale:x"`
+		S string
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal invalid scale got error %v, want TagErr", err)
+	}
+	// lengthref 只接受 scale、adjust 选项，其他选项不能影响校验、字节序等标签
+	if _, err := Marshal(struct {
+		N uint8 `bytecodec:"lengthref:S,scal:4"`
+		S string
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal unknown lengthref option got error %v, want TagErr", err)
+	}
+	for _, tag := range []string{"lengthref:S,from:N", "lengthref:S,le:"} {
+		parsed := parseTag(tag)
+		if parsed.lengthErr == nil || parsed.checksumFrom != "" || parsed.byteOrder != nil {
+			t.Errorf("parseTag(%q) = %+v, want lengthErr", tag, parsed)
+		}
+	}
+	// 保留第一个错误
+	if err := parseTag("lengthref:S,scale:x;sizeref:S").lengthErr; err == nil || !strings.Contains(err.Error(), "scale") {
+		t.Errorf("parseTag conflicting invalid lengthref got error %v, want scale error", err)
+	}
+}
+
+type spanPacket struct {
+	BodyLen uint16 `bytecodec:"lengthref:Kind..Data"`
+	Kind    uint8
+	Name    string `bytecodec:"cstring"`
+	Data    []byte
+	VarLen  uint32 `bytecodec:"uvarint;sizeref:A..B;adjust:1"`
+	A       uint16
+	B       string
+	C       uint8
+	D       string `bytecodec:"cstring"`
+	TailLen uint8  `bytecodec:"lengthref:C..D"`
+}
+
+var spanTests = []testcase{{
+	[]byte{
+		0x0, 0x5,
+		0x1,
+		0x61, 0x0,
+		0xa, 0xb,
+		0x6,
+		0x0, 0x2, 0x78, 0x79, 0x7a,
+		0x3, 0x64, 0x65, 0x0,
+		0x4,
+	},
+	&spanPacket{},
+	&spanPacket{5, 1, "a", []byte{0xa, 0xb}, 6, 2, "xyz", 3, "de", 4},
+}, {
+	[]byte{
+		0x0, 0x2,
+		0x1,
+		0x0,
+		0x3,
+		0x0, 0x0,
+		0x0, 0x0,
+		0x2,
+	},
+	&spanPacket{},
+	&spanPacket{2, 1, "", []byte{}, 3, 0, "", 0, "", 2},
+}}
+
+func TestSpanLengthref(t *testing.T) {
+	testMarshalUnmarshal(t, spanTests)
+
+	// 变长的 lengthref 字段回填后长度变化，之后的字节需要移动
+	p := spanPacket{Kind: 1, B: strings.Repeat("a", 200)}
+	b, err := Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal unexpected error: %s", err)
+	}
+	want := append([]byte{0x0, 0x2, 0x1, 0x0, 0xcb, 0x1, 0x0, 0x0}, strings.Repeat("a", 200)...)
+	want = append(want, 0x0, 0x0, 0x2)
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("Marshal = %#v, want %#v", b, want)
+	}
+
+	// 输入中 span 的长度远远超过剩余的数据时返回 ErrShortData，不会按照这个长度分配空间
+	if err := Unmarshal([]byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x1, 0x2}, &struct {
+		N int64 `bytecodec:"lengthref:A..B"`
+		A uint8
+		B uint8
+	}{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Unmarshal huge span length got error %v, want ErrShortData", err)
+	}
+
+	var te *TagErr
+	if _, err := Marshal(struct {
+		N uint8 `bytecodec:"lengthref:B..A"`
+		A uint8
+		B uint8
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal invalid span got error %v, want TagErr", err)
+	}
+	if _, err := Marshal(struct {
+		N uint8 `bytecodec:"countref:A..B"`
+		A []uint8
+		B uint8
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Marshal countref span got error %v, want TagErr", err)
+	}
+}
+
+type crossHeader struct {
+	MsgID   uint16
+	BodyLen uint16 `bytecodec:"lengthref:^.Body"`
+}
+
+type crossBody struct {
+	Kind    uint8
+	Payload []byte
+	Note    string `bytecodec:"cstring"`
+}
+
+type crossTrailer struct {
+	BodyLen uint8 `bytecodec:"lengthref:^.Body"`
+}
+
+type crossPacket struct {
+	Header  crossHeader
+	PayLen  uint8 `bytecodec:"lengthref:Body.Payload"`
+	Body    crossBody
+	Trailer crossTrailer
+}
+
+var crossTests = []testcase{{
+	[]byte{
+		0x1, 0x2, 0x0, 0x6,
+		0x3,
+		0x1, 0xa, 0xb, 0xc, 0x78, 0x0,
+		0x6,
+	},
+	&crossPacket{},
+	&crossPacket{crossHeader{0x0102, 6}, 3, crossBody{1, []byte{0xa, 0xb, 0xc}, "x"}, crossTrailer{6}},
+}, {
+	[]byte{
+		0x1, 0x2, 0x0, 0x2,
+		0x0,
+		0x1, 0x0,
+		0x2,
+	},
+	&crossPacket{},
+	&crossPacket{crossHeader{0x0102, 2}, 0, crossBody{1, []byte{}, ""}, crossTrailer{2}},
+}}
+
+// crossSummed 的校验范围包含等待外层字段回填的 lengthref
+type crossSummed struct {
+	BodyLen uint8 `bytecodec:"lengthref:^.Body"`
+	Sum     uint8 `bytecodec:"checksum:sum8"`
+}
+
+type crossSummedPacket struct {
+	Header crossSummed
+	Body   []byte
+}
+
+type crossDeepLen struct {
+	BodyLen uint8 `bytecodec:"lengthref:^.^.Body"`
+}
+
+// crossDeepHead 的校验范围包含内层结构体中等待回填的 lengthref
+type crossDeepHead struct {
+	Len crossDeepLen
+	Sum uint8 `bytecodec:"checksum:sum8"`
+}
+
+type crossDeepPacket struct {
+	Header crossDeepHead
+	Body   []byte
+}
+
+// crossSpanPacket 回填变长编码的 Len 时移动之后的字节，Header.BodyLen 仍然回填到正确的位置
+type crossSpanPacket struct {
+	Len    uint16 `bytecodec:"uvarint;lengthref:Header..Header"`
+	Header crossHeader
+	Body   []byte
+}
+
+var crossChecksumTests = []testcase{{
+	[]byte{0x3, 0x3, 0xa, 0xb, 0xc},
+	&crossSummedPacket{},
+	&crossSummedPacket{crossSummed{3, 3}, []byte{0xa, 0xb, 0xc}},
+}, {
+	[]byte{0x3, 0x3, 0xa, 0xb, 0xc},
+	&crossDeepPacket{},
+	&crossDeepPacket{crossDeepHead{crossDeepLen{3}, 3}, []byte{0xa, 0xb, 0xc}},
+}, {
+	[]byte{0x4, 0x0, 0x1, 0x0, 0x2, 0xa, 0xb},
+	&crossSpanPacket{},
+	&crossSpanPacket{4, crossHeader{1, 2}, []byte{0xa, 0xb}},
+}}
+
+func TestCrossLengthref(t *testing.T) {
+	testMarshalUnmarshal(t, crossTests)
+	testMarshalUnmarshal(t, crossChecksumTests)
+
+	var te *TagErr
+	for _, v := range []interface{}{
+		struct {
+			N uint8 `bytecodec:"lengthref:A.B"`
+			A uint8
+		}{},
+		struct {
+			N uint8 `bytecodec:"lengthref:^.A"`
+			A uint8
+		}{},
+		struct {
+			H crossTrailer
+			A uint8
+		}{},
+		struct {
+			N uint8 `bytecodec:"lengthref:A..B.C"`
+			A uint8
+			B crossBody
+		}{},
+	} {
+		if _, err := Marshal(v); !errors.As(err, &te) {
+			t.Errorf("Marshal %T got error %v, want TagErr", v, err)
+		}
+	}
+
+	// 解码时和编码一样，lengthref 在指向的字段中或者路径经过已经解码的结构体时返回 TagErr
+	for _, v := range []interface{}{
+		&struct {
+			Body crossTrailer
+		}{},
+		&struct {
+			Body    checksumHeader
+			Trailer struct {
+				N uint8 `bytecodec:"lengthref:^.Body.Type"`
+			}
+		}{},
+	} {
+		if err := Unmarshal([]byte{0x1, 0x2, 0x1}, v); !errors.As(err, &te) {
+			t.Errorf("Unmarshal %T got error %v, want TagErr", v, err)
+		}
+	}
+}
+
+// pairCoder 只读取 2 个字节
+type pairCoder struct{ A, B byte }
+
+func (p pairCoder) MarshalBytes(cs *CodecState) error {
+	cs.Write([]byte{p.A, p.B})
+	return nil
+}
+
+func (p *pairCoder) UnmarshalBytes(cs *CodecState) error {
+	b := make([]byte, 2)
+	cs.ReadFull(b)
+	p.A, p.B = b[0], b[1]
+	return nil
+}
+
+type boundedItem struct {
+	Kind uint8
+	Seq  uint16
+}
+
+type boundedPacket struct {
+	ItemLen uint8 `bytecodec:"lengthref:Item"`
+	Item    boundedItem
+	PairLen uint8 `bytecodec:"sizeref:Pair"`
+	Pair    pairCoder
+	Tail    uint8
+}
+
+func TestBoundedDecode(t *testing.T) {
+	b := []byte{0x3, 0x1, 0x0, 0x2, 0x2, 0xa, 0xb, 0xff}
+	var p boundedPacket
+	if err := Unmarshal(b, &p); err != nil {
+		t.Fatalf("Unmarshal unexpected error: %s", err)
+	}
+	want := boundedPacket{3, boundedItem{1, 2}, 2, pairCoder{0xa, 0xb}, 0xff}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("Unmarshal = %#v, want %#v", p, want)
+	}
+
+	for _, c := range []struct {
+		b    []byte
+		path string
+		want BoundsError
+	}{
+		// 结构体只需要 3 个字节，多出的字节不会被当作之后的字段
+		{[]byte{0x4, 0x1, 0x0, 0x2, 0x0, 0x2, 0xa, 0xb, 0xff}, "boundedPacket.Item", BoundsError{4, 3}},
+		// 读取超出范围时保留内层字段的路径
+		{[]byte{0x2, 0x1, 0x0, 0x2, 0x2, 0xa, 0xb, 0xff}, "boundedPacket.Item.Seq", BoundsError{2, -1}},
+		{[]byte{0x3, 0x1, 0x0, 0x2, 0x3, 0xa, 0xb, 0xc, 0xff}, "boundedPacket.Pair", BoundsError{3, 2}},
+		{[]byte{0x3, 0x1, 0x0, 0x2, 0x1, 0xa, 0xb, 0xff}, "boundedPacket.Pair", BoundsError{1, -1}},
+	} {
+		var fe *FieldError
+		var be *BoundsError
+		err := Unmarshal(c.b, &boundedPacket{})
+		if !errors.As(err, &fe) || !errors.As(err, &be) || *be != c.want || fe.Path != c.path {
+			t.Errorf("Unmarshal %#v got error %v, want %s %#v", c.b, err, c.path, c.want)
+			continue
+		}
+		if errors.Is(err, ErrShortData) != (c.want.Read < 0) {
+			t.Errorf("Unmarshal %#v errors.Is(err, ErrShortData) = %v", c.b, errors.Is(err, ErrShortData))
+		}
+	}
+
+	// lengthref:A..D 覆盖的字段同样需要正好读完
+	var be *BoundsError
+	err := Unmarshal([]byte{0x4, 0x1, 0x0, 0x2, 0x0}, &struct {
+		N uint8 `bytecodec:"lengthref:A..B"`
+		A uint8
+		B uint16
+	}{})
+	if !errors.As(err, &be) || *be != (BoundsError{4, 3}) {
+		t.Errorf("Unmarshal span got error %v, want BoundsError{4, 3}", err)
+	}
+
+	// 输入中的长度远远超过剩余的数据时返回 ErrShortData，不会按照这个长度分配空间
+	huge := []byte{0x40, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x2}
+	type hugeItem struct {
+		Len  uint64 `bytecodec:"lengthref:Item"`
+		Item boundedItem
+	}
+	if err := Unmarshal(huge, &hugeItem{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Unmarshal huge length got error %v, want ErrShortData", err)
+	}
+	if err := NewDecoder(bytes.NewReader(huge)).Decode(&hugeItem{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Decode huge length got error %v, want ErrShortData", err)
+	}
+	if err := Unmarshal(huge, &struct {
+		Len uint64 `bytecodec:"lengthref:S"`
+		S   string
+	}{}); !errors.Is(err, ErrShortData) {
+		t.Errorf("Unmarshal huge string length got error %v, want ErrShortData", err)
+	}
+
+	// 只查看 Bytes 而不读取数据的 ByteCoder 没有读完 lengthref 指定的字节
+	err = Unmarshal([]byte{0x2, 'b', 'c'}, &struct {
+		N uint8 `bytecodec:"lengthref:C"`
+		C bytecoder
+	}{})
+	if !errors.As(err, &be) || *be != (BoundsError{2, 0}) {
+		t.Errorf("Unmarshal peeking ByteCoder got error %v, want BoundsError{2, 0}", err)
+	}
+}
+
+type overflowLengthref struct {
+	Len  uint8 `bytecodec:"lengthref:Data"`
+	Data string
+}
+
+type wrapLengthref struct {
+	Len  uint8 `bytecodec:"lengthref:Data;wrap"`
+	Data string
+}
+
+func TestOverflowLengthref(t *testing.T) {
+	data := strings.Repeat("a", 300)
+	var oe *OverflowError
+	var fe *FieldError
+	_, err := Marshal(overflowLengthref{Data: data})
+	if !errors.As(err, &oe) || *oe != (OverflowError{"Len", 8, int64(300)}) {
+		t.Fatalf("Marshal got error %v, want OverflowError", err)
+	}
+	// 回填长度时出错，错误指向 lengthref 字段而不是它指向的字段
+	if !errors.As(err, &fe) || fe.Path != "overflowLengthref.Len" || fe.Offset != 0 || fe.Type != reflect.TypeOf(uint8(0)) {
+		t.Errorf("Marshal got error %v, want FieldError overflowLengthref.Len at offset 0", err)
+	}
+	_, err = Marshal(&struct {
+		Len uint8 `bytecodec:"lengthref:S"`
+		S   []byte
+	}{S: make([]byte, 300)})
+	if !errors.As(err, &oe) || !errors.As(err, &fe) || fe.Path != "Len" || fe.Offset != 0 {
+		t.Errorf("Marshal slice got error %v, want FieldError Len at offset 0", err)
+	}
+	_, err = Marshal(&struct {
+		ID     uint8
+		Header crossTrailer
+		Body   []byte
+	}{Body: make([]byte, 300)})
+	if !errors.As(err, &oe) || !errors.As(err, &fe) || fe.Path != "Header.BodyLen" || fe.Offset != 1 {
+		t.Errorf("Marshal cross lengthref got error %v, want FieldError Header.BodyLen at offset 1", err)
+	}
+
+	// wrap 标签写入长度的低 8 位，300 & 0xff = 44
+	b, err := Marshal(wrapLengthref{Data: data})
+	if err != nil || b[0] != 44 || len(b) != 301 {
+		t.Errorf("Marshal wrap = %#v, %v, want length 44", b[:1], err)
+	}
+
+	for _, v := range []interface{}{
+		struct {
+			Len  int8 `bytecodec:"lengthref:Data"`
+			Data []byte
+		}{Data: make([]byte, 128)},
+		struct {
+			Len  uint16 `bytecodec:"lengthref:Data,scale:2,adjust:2"`
+			Data []byte
+		}{Data: make([]byte, 0x20000)},
+		struct {
+			Len  uint8 `bytecodec:"bits:4;lengthref:Data"`
+			_    uint8 `bytecodec:"bits:4"`
+			Data string
+		}{Data: "0123456789abcdef"},
+	} {
+		if _, err := Marshal(v); !errors.As(err, &oe) {
+			t.Errorf("Marshal %T got error %v, want OverflowError", v, err)
+		}
+	}
+
+	if err := Unmarshal([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, &struct {
+		Len  uint64 `bytecodec:"lengthref:Data"`
+		Data []byte
+	}{}); !errors.As(err, &oe) {
+		t.Errorf("Unmarshal got error %v, want OverflowError", err)
+	}
+
+	// 有符号和浮点数的 lengthref 同样检查负数和溢出
+	var le *LengthErr
+	if err := Unmarshal([]byte{0xff, 0xff, 0xff, 0xfe, 0x1, 0x2}, &struct {
+		Len  int32 `bytecodec:"lengthref:Data,adjust:-4"`
+		Data []byte
+	}{}); !errors.As(err, &le) {
+		t.Errorf("Unmarshal negative int32 lengthref got error %v, want LengthErr", err)
+	}
+	if err := Unmarshal([]byte{0xbf, 0x80, 0x0, 0x0}, &struct {
+		Len  float32 `bytecodec:"lengthref:Data"`
+		Data []byte
+	}{}); !errors.As(err, &le) {
+		t.Errorf("Unmarshal negative float32 lengthref got error %v, want LengthErr", err)
+	}
+	if err := Unmarshal([]byte{0x7f, 0xf8, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1}, &struct {
+		Len  float64 `bytecodec:"lengthref:Data"`
+		Data []byte
+	}{}); !errors.As(err, &oe) {
+		t.Errorf("Unmarshal NaN float64 lengthref got error %v, want OverflowError", err)
+	}
+	if err := Unmarshal([]byte{0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, &struct {
+		Len  int64 `bytecodec:"lengthref:Data,scale:4"`
+		Data []byte
+	}{}); !errors.As(err, &oe) {
+		t.Errorf("Unmarshal scaled int64 lengthref got error %v, want OverflowError", err)
+	}
+}
+
+type truncateTag struct {
+	UTF8 string `bytecodec:"length:4;truncate"`
+	GBK  string `bytecodec:"gbk;length:3;pad:space;truncate"`
+	Left string `bytecodec:"length:4;pad:space,left;truncate"`
+}
+
+func TestTruncateTag(t *testing.T) {
+	b, err := Marshal(truncateTag{"abcdef", "测试", "中文"})
+	want := []byte{
+		0x61, 0x62, 0x63, 0x64,
+		0xb2, 0xe2, 0x20,
+		0x20, 0xe4, 0xb8, 0xad,
+	}
+	if err != nil || !reflect.DeepEqual(b, want) {
+		t.Errorf("Marshal = %#v, %v, want %#v", b, err, want)
+	}
+
+	// 截断到字符边界后长度不足，并且没有 pad 标签
+	var le *LengthErr
+	if _, err := Marshal(truncateTag{"ab中文", "", ""}); !errors.As(err, &le) {
+		t.Errorf("Marshal got error %v, want LengthErr", err)
+	}
+}
+
 type lengthTag struct {
 	Slice []uint16 `bytecodec:"length:2"`
 	Str   string   `bytecodec:"length:4"`
@@ -533,6 +1314,25 @@ func (bc *bytecoder) UnmarshalBytes(cs *CodecState) error {
 	return nil
 }
 
+// readCoder 和 bytecoder 相同，但解码时读取使用的字节，可以用于 lengthref 限定了长度的字段
+type readCoder struct {
+	s string
+}
+
+func (rc readCoder) MarshalBytes(cs *CodecState) error {
+	return bytecoder{rc.s}.MarshalBytes(cs)
+}
+
+func (rc *readCoder) UnmarshalBytes(cs *CodecState) error {
+	sb := make([]byte, cs.Len())
+	cs.ReadFull(sb)
+	for i := range sb {
+		sb[i]--
+	}
+	rc.s = string(sb)
+	return nil
+}
+
 var byteCoderTests = []testcase{{
 	[]byte{231, 182, 140, 233, 176, 150},
 	&bytecoder{""},
@@ -624,7 +1424,8 @@ var unsupportedValues = []interface{}{
 func TestUnsupportedValues(t *testing.T) {
 	for _, v := range unsupportedValues {
 		if _, err := Marshal(v); err != nil {
-			if _, ok := err.(*UnsupportedValueError); !ok {
+			var uve *UnsupportedValueError
+			if !errors.As(err, &uve) {
 				t.Errorf("for %v, got %T want UnsupportedValueError", v, err)
 			}
 		} else {
@@ -632,3 +1433,348 @@ func TestUnsupportedValues(t *testing.T) {
 		}
 	}
 }
+
+type byteOrderTag struct {
+	BE      uint16   `bytecodec:"be"`
+	LE      uint16   `bytecodec:"le"`
+	Int32   int32    `bytecodec:"le"`
+	Float32 float32  `bytecodec:"le"`
+	Length  uint16   `bytecodec:"lengthref:Slice;le"`
+	Slice   []uint16 `bytecodec:"le"`
+}
+
+var byteOrderTagTests = []testcase{{
+	[]byte{
+		0x0, 0x1,
+		0x1, 0x0,
+		0xfe, 0xff, 0xff, 0xff,
+		0x0, 0x0, 0x80, 0x3f,
+		0x2, 0x0,
+		0x1, 0x0, 0x2, 0x0,
+	},
+	&byteOrderTag{},
+	&byteOrderTag{
+		BE:      1,
+		LE:      1,
+		Int32:   -2,
+		Float32: 1,
+		Length:  2,
+		Slice:   []uint16{1, 2},
+	},
+}}
+
+func TestByteOrderTag(t *testing.T) {
+	testMarshalUnmarshal(t, byteOrderTagTests)
+}
+
+type littleEndianStruct struct {
+	_      struct{} `bytecodec:"le"`
+	Uint16 uint16
+	Uint32 uint32
+	BE     uint16 `bytecodec:"be"`
+}
+
+type mixedByteOrder struct {
+	Default uint16
+	LE      littleEndianStruct
+	BE      littleEndianStruct `bytecodec:"be"`
+}
+
+var mixedByteOrderTests = []testcase{{
+	[]byte{
+		0x0, 0x1,
+		0x2, 0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x4,
+		0x0, 0x2, 0x0, 0x0, 0x0, 0x3, 0x0, 0x4,
+	},
+	&mixedByteOrder{},
+	&mixedByteOrder{
+		Default: 1,
+		LE:      littleEndianStruct{Uint16: 2, Uint32: 3, BE: 4},
+		BE:      littleEndianStruct{Uint16: 2, Uint32: 3, BE: 4},
+	},
+}}
+
+// 之后的 _ 字段没有 le、be 标签，不会覆盖之前声明的字节序
+type twoBlankFields struct {
+	_      struct{} `bytecodec:"le"`
+	Uint16 uint16
+	_      struct{}
+	Uint32 uint32
+}
+
+func TestStructByteOrder(t *testing.T) {
+	testMarshalUnmarshal(t, mixedByteOrderTests)
+	testMarshalUnmarshal(t, []testcase{{
+		[]byte{0x1, 0x0, 0x2, 0x0, 0x0, 0x0},
+		&twoBlankFields{},
+		&twoBlankFields{Uint16: 1, Uint32: 2},
+	}})
+}
+
+type byteOrderOptions struct {
+	Uint16 uint16
+	Length uint32 `bytecodec:"lengthref:Slice"`
+	Slice  []int16
+	BE     uint16 `bytecodec:"be"`
+}
+
+func TestByteOrderOptions(t *testing.T) {
+	b := []byte{
+		0x1, 0x0,
+		0x2, 0x0, 0x0, 0x0,
+		0xff, 0xff, 0x2, 0x0,
+		0x0, 0x3,
+	}
+	v := &byteOrderOptions{Uint16: 1, Length: 2, Slice: []int16{-1, 2}, BE: 3}
+
+	bout, err := MarshalOptions{ByteOrder: binary.LittleEndian}.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal %#v, unexpected error: %s", v, err)
+	}
+	if !reflect.DeepEqual(bout, b) {
+		t.Errorf("Marshal %#v = %#v, want %#v", v, bout, b)
+	}
+
+	out := &byteOrderOptions{}
+	err = UnmarshalOptions{ByteOrder: binary.LittleEndian}.Unmarshal(b, out)
+	if err != nil {
+		t.Fatalf("Unmarshal %#v, unexpected error: %s", b, err)
+	}
+	if !reflect.DeepEqual(out, v) {
+		t.Errorf("Unmarshal %#v = %#v, want %#v", b, out, v)
+	}
+}
+
+type concurrentLengthref struct {
+	Length uint8 `bytecodec:"lengthref:Str"`
+	Str    string
+	Count  uint8 `bytecodec:"lengthref:Slice"`
+	Slice  []uint16
+	Tail   string
+}
+
+func TestConcurrentLengthrefDecode(t *testing.T) {
+	const workers = 8
+	const messages = 200
+
+	var data [][]byte
+	var values []*concurrentLengthref
+	for i := 0; i < messages; i++ {
+		v := &concurrentLengthref{
+			Length: uint8(i % 17),
+			Str:    string(bytes.Repeat([]byte{'s'}, i%17)),
+			Count:  uint8(i % 5),
+			Slice:  make([]uint16, i%5),
+			Tail:   fmt.Sprint(i),
+		}
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal %#v, unexpected error: %s", v, err)
+		}
+		data = append(data, b)
+		values = append(values, v)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				n := (i*workers + w) % messages
+				out := &concurrentLengthref{}
+				if err := Unmarshal(data[n], out); err != nil {
+					errs <- err
+					return
+				}
+				if !reflect.DeepEqual(out, values[n]) {
+					errs <- fmt.Errorf("Unmarshal %#v = %#v, want %#v", data[n], out, values[n])
+					return
+				}
+				if _, err := Marshal(out); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+type backpatchLengthref struct {
+	CoderLength uint16 `bytecodec:"lengthref:Coder"` // ByteCoder 使用编码后的字节长度
+	Coder       readCoder
+	Items       []uint8 `bytecodec:"length:2"`
+	ItemsLength uint8   `bytecodec:"lengthref:Items"`
+	TailLength  uint32  `bytecodec:"uvarint;lengthref:Tail"`
+	Tail        string
+}
+
+type leadingChecksum struct {
+	Xor uint8  `bytecodec:"checksum:xor;from:A;to:B"`
+	Sum uint16 `bytecodec:"checksum:sum8;uvarint;from:A;to:B"`
+	A   uint8
+	B   uint8
+}
+
+var backpatchTests = []testcase{{
+	[]byte{0x0, 0x2, 'b', 'c', 0x1, 0x2, 0x2, 0x3, 'x', 'y', 'z'},
+	&backpatchLengthref{},
+	&backpatchLengthref{CoderLength: 2, Coder: readCoder{"ab"}, Items: []uint8{1, 2}, ItemsLength: 2, TailLength: 3, Tail: "xyz"},
+}, {
+	[]byte{0x0, 0xfe, 0x1, 0x7f, 0x7f},
+	&leadingChecksum{},
+	&leadingChecksum{Xor: 0, Sum: 0xfe, A: 0x7f, B: 0x7f},
+}, {
+	[]byte{0x3, 0x3, 0x1, 0x2},
+	&leadingChecksum{},
+	&leadingChecksum{Xor: 3, Sum: 3, A: 1, B: 2},
+}}
+
+func TestBackpatch(t *testing.T) {
+	testMarshalUnmarshal(t, backpatchTests)
+}
+
+func TestDisallowTrailingBytes(t *testing.T) {
+	b := []byte{0x0, 0x1, 0x2, 0x3, 0x4}
+	if err := Unmarshal(b, &struct{ A, B uint16 }{}); err != nil {
+		t.Fatalf("Unmarshal unexpected error: %s", err)
+	}
+
+	opts := UnmarshalOptions{DisallowTrailingBytes: true}
+	err := opts.Unmarshal(b, &struct{ A, B uint16 }{})
+	var te *TrailingDataError
+	if !errors.As(err, &te) || te.Offset != 4 || te.Count != 1 {
+		t.Errorf("Unmarshal trailing bytes error = %v, want offset 4 count 1", err)
+	}
+	if err := opts.Unmarshal(b[:4], &struct{ A, B uint16 }{}); err != nil {
+		t.Errorf("Unmarshal without trailing bytes unexpected error: %s", err)
+	}
+}
+
+func TestUnmarshalPrefix(t *testing.T) {
+	data := []byte{
+		0x0, 0x1, 0x2, 'o', 'k',
+		0x0, 0x2, 0x0,
+		0x0, 0x3, 0x5, 'e', 'r',
+	}
+	want := []lengthrefPrefix{{1, 2, "ok"}, {2, 0, ""}}
+	for i := 0; len(data) > 0; i++ {
+		var out lengthrefPrefix
+		n, err := UnmarshalPrefix(data, &out)
+		if i == len(want) {
+			if !errors.Is(err, ErrShortData) || n != 5 {
+				t.Errorf("UnmarshalPrefix short data = %d, %v, want 5 and ErrShortData", n, err)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("UnmarshalPrefix unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(out, want[i]) {
+			t.Errorf("UnmarshalPrefix = %#v, want %#v", out, want[i])
+		}
+		data = data[n:]
+	}
+}
+
+type lengthrefPrefix struct {
+	SerialNo uint16
+	Length   uint8 `bytecodec:"lengthref:Msg"`
+	Msg      string
+}
+
+// prefixList 是连续存放的 lengthrefPrefix，在自定义 ByteCoder 中使用 CodecState.UnmarshalPrefix 解码
+type prefixList struct {
+	items []lengthrefPrefix
+	sizes []int
+}
+
+func (l prefixList) MarshalBytes(cs *CodecState) error {
+	for _, item := range l.items {
+		cs.EncodeField(item, ParseFieldTag(""))
+	}
+	return nil
+}
+
+func (l *prefixList) UnmarshalBytes(cs *CodecState) error {
+	for cs.More() {
+		var item lengthrefPrefix
+		n, err := cs.UnmarshalPrefix(&item)
+		if err != nil {
+			return err
+		}
+		l.items = append(l.items, item)
+		l.sizes = append(l.sizes, n)
+	}
+	return nil
+}
+
+func TestCodecStateUnmarshalPrefix(t *testing.T) {
+	want := prefixList{items: []lengthrefPrefix{{1, 2, "ok"}, {2, 0, ""}}}
+	b, err := Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal %#v, unexpected error: %s", want, err)
+	}
+	out := &prefixList{}
+	if err := Unmarshal(b, out); err != nil {
+		t.Fatalf("Unmarshal unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(out.items, want.items) || !reflect.DeepEqual(out.sizes, []int{5, 3}) {
+		t.Errorf("Unmarshal = %#v, want %#v sizes [5 3]", out, want)
+	}
+}
+
+type fieldErrHeader struct {
+	SerialNo uint16
+	Phone    string `bytecodec:"bcd8421:2,false"`
+}
+
+type fieldErrPacket struct {
+	Header fieldErrHeader
+	Length uint8 `bytecodec:"lengthref:Body"`
+	Body   struct {
+		Name string `bytecodec:"length:4"`
+		Seq  uint32
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	for _, c := range []struct {
+		b      []byte
+		path   string
+		typ    reflect.Type
+		offset int
+		target error
+	}{
+		{[]byte{0x0, 0x1, 0x12}, "fieldErrPacket.Header.Phone", reflect.TypeOf(""), 2, ErrShortData},
+		{[]byte{0x0, 0x1, 0x12, 0x34, 0x6, 'a', 'b', 'c', 'd', 0x0, 0x0}, "fieldErrPacket.Body.Seq", reflect.TypeOf(uint32(0)), 9, ErrShortData},
+		{[]byte{0x0, 0x1, 0x12, 0x34, 0x9, 'a', 'b', 'c', 'd', 0x0, 0x0, 0x0, 0x0}, "fieldErrPacket.Body", nil, 5, ErrShortData},
+	} {
+		var fe *FieldError
+		err := Unmarshal(c.b, &fieldErrPacket{})
+		if !errors.As(err, &fe) || !errors.Is(err, c.target) {
+			t.Fatalf("Unmarshal %#v error %v, want FieldError wrapping %v", c.b, err, c.target)
+		}
+		if fe.Path != c.path || fe.Offset != c.offset || (c.typ != nil && fe.Type != c.typ) {
+			t.Errorf("Unmarshal %#v FieldError %s %s %d, want %s %s %d", c.b, fe.Path, fe.Type, fe.Offset, c.path, c.typ, c.offset)
+		}
+	}
+
+	p := fieldErrPacket{Header: fieldErrHeader{1, "1234"}}
+	p.Body.Name = "abc"
+	_, err := Marshal(p)
+	var fe *FieldError
+	var le *LengthErr
+	if !errors.As(err, &fe) || !errors.As(err, &le) {
+		t.Fatalf("Marshal error %v, want FieldError wrapping LengthErr", err)
+	}
+	if fe.Path != "fieldErrPacket.Body.Name" || fe.Offset != 5 {
+		t.Errorf("Marshal FieldError %s %d, want fieldErrPacket.Body.Name 5", fe.Path, fe.Offset)
+	}
+}
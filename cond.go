@@ -0,0 +1,125 @@
+package bytecodec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// condition 是 if 标签中的条件，例如 Flags&0x20、Version>=2，
+// 只有字段名时表示这个字段不为 0 或者为 true
+type condition struct {
+	field string
+	op    string
+	value int64
+}
+
+var condOps = []string{">=", "<=", "!=", "==", ">", "<", "&"}
+
+func parseCondition(expr string) (*condition, error) {
+	expr = strings.TrimSpace(expr)
+	for _, op := range condOps {
+		i := strings.Index(expr, op)
+		if i < 0 {
+			continue
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(expr[i+len(op):]), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %q: %v", expr, err)
+		}
+		return &condition{field: strings.TrimSpace(expr[:i]), op: op, value: value}, nil
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("empty condition")
+	}
+	return &condition{field: expr, op: "!=", value: 0}, nil
+}
+
+// compareValue 比较字段的值和 n，返回 -1、0、1
+func compareValue(v reflect.Value, n int64) int {
+	var a int64
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			a = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		a = v.Int()
+	default:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return 1
+		}
+		a = int64(u)
+	}
+	switch {
+	case a < n:
+		return -1
+	case a > n:
+		return 1
+	}
+	return 0
+}
+
+func (cond *condition) eval(v reflect.Value) bool {
+	switch cond.op {
+	case "&":
+		var u uint64
+		switch v.Kind() {
+		case reflect.Bool:
+			if v.Bool() {
+				u = 1
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			u = uint64(v.Int())
+		default:
+			u = v.Uint()
+		}
+		return u&uint64(cond.value) != 0
+	case ">=":
+		return compareValue(v, cond.value) >= 0
+	case "<=":
+		return compareValue(v, cond.value) <= 0
+	case "!=":
+		return compareValue(v, cond.value) != 0
+	case "==":
+		return compareValue(v, cond.value) == 0
+	case ">":
+		return compareValue(v, cond.value) > 0
+	default:
+		return compareValue(v, cond.value) < 0
+	}
+}
+
+// present 返回字段是否需要编解码，if 标签的条件只能引用这个字段之前的字段，
+// 这样解码时条件中使用的字段已经解码完成
+func (sc structCoder) present(c *CodecState, v reflect.Value, i int) bool {
+	f := sc.fields.list[i]
+	if f.tagOptions.condErr != nil {
+		c.error(&TagErr{fmt.Errorf("if %s %v", f.name, f.tagOptions.condErr)})
+	}
+	cond := f.tagOptions.cond
+	if cond == nil {
+		return true
+	}
+
+	for j := 0; j < i; j++ {
+		ref := sc.fields.list[j]
+		if ref.name != cond.field {
+			continue
+		}
+		rv := v.Field(ref.index)
+		switch rv.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			c.error(&TagErr{fmt.Errorf("if %s field %s type %q is invalid", f.name, cond.field, rv.Kind())})
+		}
+		return cond.eval(rv)
+	}
+	c.error(&TagErr{fmt.Errorf("if %s not fount field %s before it", f.name, cond.field)})
+	return false
+}
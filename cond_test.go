@@ -0,0 +1,63 @@
+package bytecodec
+
+import "testing"
+
+type condTag struct {
+	Version  uint8
+	Flags    uint16
+	Ext      uint32 `bytecodec:"if:Flags&0x20"`
+	V2       uint8  `bytecodec:"if:Version>=2"`
+	V1       uint8  `bytecodec:"if:Version==1"`
+	HasName  bool
+	NameLen  uint8  `bytecodec:"lengthref:Name;if:HasName"`
+	Name     string `bytecodec:"if:HasName"`
+	Trailing uint8
+}
+
+var condTests = []testcase{{
+	[]byte{
+		0x2,
+		0x0, 0x21,
+		0x0, 0x0, 0x0, 0x7,
+		0x8,
+		0x1,
+		0x2, 0x61, 0x62,
+		0x9,
+	},
+	&condTag{},
+	&condTag{Version: 2, Flags: 0x21, Ext: 7, V2: 8, HasName: true, NameLen: 2, Name: "ab", Trailing: 9},
+}, {
+	[]byte{
+		0x1,
+		0x0, 0x1,
+		0x6,
+		0x0,
+		0x9,
+	},
+	&condTag{},
+	&condTag{Version: 1, Flags: 0x1, V1: 6, Trailing: 9},
+}}
+
+func TestCondTag(t *testing.T) {
+	testMarshalUnmarshal(t, condTests)
+}
+
+type condAfter struct {
+	A uint8 `bytecodec:"if:B>0"`
+	B uint8
+}
+
+type condInvalid struct {
+	A uint8
+	B uint8 `bytecodec:"if:A>=x"`
+}
+
+func TestCondTagErr(t *testing.T) {
+	for _, v := range []interface{}{&condAfter{}, &condInvalid{}} {
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("Marshal %#v, expected error", v)
+		} else if _, ok := err.(*TagErr); !ok {
+			t.Errorf("Marshal %#v error = %v, want TagErr", v, err)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// refPath 是 lengthref 中跨结构体的字段路径，例如 ^.Body、Body.Payload、^.^.Body.Payload
+// ^ 表示外层结构体，之后的字段名从这一层结构体开始向内查找
+type refPath struct {
+	up   int
+	down []string
+}
+
+func parseRefPath(ref string) (*refPath, error) {
+	p := &refPath{}
+	rest := ref
+	for strings.HasPrefix(rest, "^.") {
+		p.up++
+		rest = rest[2:]
+	}
+	p.down = strings.Split(rest, ".")
+	for _, name := range p.down {
+		if name == "" || name == "^" {
+			return nil, fmt.Errorf("lengthref path %q is invalid", ref)
+		}
+	}
+	return p, nil
+}
+
+// isStructCoder 返回 cd 是否使用字段编解码结构体，实现了 ByteCoder 的结构体返回 false
+func isStructCoder(cd codec) bool {
+	for {
+		switch ec := cd.(type) {
+		case ptrCoder:
+			cd = ec.elemCodec
+		case recursiveWrapCoder:
+			ec.wg.Wait()
+			cd = *ec.elemCodec
+		case structCoder:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (sc structCoder) fieldByName(name string) int {
+	for i, f := range sc.fields.list {
+		if f.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// crossRef 是一个跨结构体的 lengthref 字段的编码状态
+// 指向的字段编码完成后通过 deliver 得到长度，lengthref 字段已经预留了位置时回填
+type crossRef struct {
+	owner   *structEncoder // lengthref 字段所在的结构体
+	index   int            // lengthref 字段的下标
+	length  int
+	done    bool
+	waiting bool
+}
+
+// pendingRef 是交给内层结构体的 crossRef，path 是从内层结构体开始的字段路径
+type pendingRef struct {
+	path []string
+	cr   *crossRef
+}
+
+func (e *structEncoder) crossState(i int) *crossRef {
+	if e.cross == nil {
+		e.cross = map[int]*crossRef{}
+	}
+	cr, ok := e.cross[i]
+	if !ok {
+		cr = &crossRef{owner: e, index: i}
+		e.cross[i] = cr
+	}
+	return cr
+}
+
+// crossLengthref 返回跨结构体的 lengthref 字段需要写入的值，长度还不知道时预留位置，这时返回的 ok 为 false
+func (e *structEncoder) crossLengthref(i int, f field) (lengthv reflect.Value, ok bool) {
+	c := e.c
+	p := f.tagOptions.refPath
+	cr := e.crossState(i)
+	if p.up > 0 {
+		// c.encoders 的最后一个是 e 自己
+		k := len(c.encoders) - 1 - p.up
+		if k < 0 || c.encoders[k].c != c {
+			c.error(&TagErr{fmt.Errorf("lengthref %s has no enclosing struct for %s", f.name, f.tagOptions.lengthref)})
+		}
+		c.encoders[k].addRef(f, p.down, cr)
+	}
+
+	if !cr.done {
+		width, fixed := fixedWidth(f)
+		if !fixed || f.tagOptions.bits > 0 {
+			c.error(&TagErr{fmt.Errorf("lengthref %s must have a fixed width to refer to %s", f.name, f.tagOptions.lengthref)})
+		}
+		cr.waiting = true
+		c.Write(make([]byte, width))
+		return reflect.Value{}, false
+	}
+	lengthv, err := refValue(f, cr.length)
+	if err != nil {
+		c.error(err)
+	}
+	return lengthv, true
+}
+
+// addRef 在 e 中按照 path 查找 lengthref 指向的字段
+// 字段已经编码时直接得到长度，还没有编码时等待这个字段或者交给内层结构体
+func (e *structEncoder) addRef(lengthref field, path []string, cr *crossRef) {
+	c := e.c
+	idx := e.sc.fieldByName(path[0])
+	if idx < 0 {
+		c.error(&TagErr{fmt.Errorf("lengthref %s not fount field %s", lengthref.name, lengthref.tagOptions.lengthref)})
+	}
+	target := e.sc.fields.list[idx]
+	if idx == e.cur {
+		c.error(&TagErr{fmt.Errorf("lengthref %s is inside its target %s", lengthref.name, lengthref.tagOptions.lengthref)})
+	}
+
+	if len(path) > 1 {
+		if idx < e.cur {
+			c.error(&TagErr{fmt.Errorf("lengthref %s target %s is encoded before it", lengthref.name, lengthref.tagOptions.lengthref)})
+		}
+		if !isStructCoder(target.codec) {
+			c.error(&TagErr{fmt.Errorf("lengthref %s field %s is not a struct", lengthref.name, target.name)})
+		}
+		if e.down == nil {
+			e.down = map[int][]pendingRef{}
+		}
+		e.down[idx] = append(e.down[idx], pendingRef{path[1:], cr})
+		return
+	}
+
+	if idx < e.cur {
+		tv := e.v.Field(target.index)
+		cr.deliver(measuredLength(c, lengthref, target, tv, e.pos[idx+1]-e.pos[idx]))
+		return
+	}
+	if e.watch == nil {
+		e.watch = map[int][]*crossRef{}
+	}
+	e.watch[idx] = append(e.watch[idx], cr)
+}
+
+// pendingRefs 返回编码字段 i 时交给内层结构体的 crossRef
+// 包括 e 中 lengthref:Body.Payload 这样向内的引用，和外层结构体交给 e 的引用
+func (e *structEncoder) pendingRefs(i int) []pendingRef {
+	pending := e.down[i]
+	if !e.sc.fields.cross {
+		return pending
+	}
+	name := e.sc.fields.list[i].name
+	for k, f := range e.sc.fields.list {
+		p := f.tagOptions.refPath
+		if p == nil || p.up > 0 || p.down[0] != name {
+			continue
+		}
+		if !isStructCoder(e.sc.fields.list[i].codec) {
+			e.c.error(&TagErr{fmt.Errorf("lengthref %s field %s is not a struct", f.name, name)})
+		}
+		pending = append(pending, pendingRef{p.down[1:], e.crossState(k)})
+	}
+	return pending
+}
+
+// deliver 记录指向的字段的长度，lengthref 字段已经预留了位置时回填
+func (cr *crossRef) deliver(length int) {
+	cr.length = length
+	cr.done = true
+	if cr.waiting {
+		cr.waiting = false
+		cr.owner.patchRef(cr.index, length)
+		cr.owner.c.resolveHeld()
+	}
+}
+
+// held 返回编码完成的 e 是否还有 lengthref 等待回填，或者有推迟计算的校验字段
+func (e *structEncoder) held() bool {
+	if len(e.deferred) > 0 {
+		return true
+	}
+	for _, cr := range e.cross {
+		if cr.waiting {
+			return true
+		}
+	}
+	return false
+}
+
+// waitingIn 返回 c 中 [start, end) 范围内是否有等待回填的跨结构体 lengthref
+// 计算校验值的结构体是 c.encoders 的最后一个或者在 c.held 中，其他正在编码的结构体的字段不会在校验范围内
+func (c *CodecState) waitingIn(start, end int) bool {
+	if n := len(c.encoders); n > 0 && c.encoders[n-1].waitingIn(start, end) {
+		return true
+	}
+	for _, e := range c.held {
+		if e.waitingIn(start, end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *structEncoder) waitingIn(start, end int) bool {
+	for i, cr := range e.cross {
+		if cr.waiting && start <= e.pos[i] && e.pos[i] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHeld 在 lengthref 回填后计算范围内不再有等待回填的字段的校验值
+// 内层结构体先编码完成，c.held 中内层在前，外层校验值覆盖的内层校验字段会先计算
+func (c *CodecState) resolveHeld() {
+	held := c.held[:0]
+	for _, e := range c.held {
+		deferred := e.deferred[:0]
+		for _, cr := range e.deferred {
+			if c.waitingIn(e.pos[cr.from], e.pos[cr.to+1]) {
+				deferred = append(deferred, cr)
+				continue
+			}
+			e.encodeChecksum(cr)
+		}
+		e.deferred = deferred
+		if e.held() {
+			held = append(held, e)
+		}
+	}
+	for i := len(held); i < len(c.held); i++ {
+		c.held[i] = nil
+	}
+	c.held = held
+}
+
+// flushHeld 在最外层结构体编码完成后计算剩下的校验值，这时等待的 lengthref 不会再被回填
+func (c *CodecState) flushHeld() {
+	for _, e := range c.held {
+		for _, cr := range e.deferred {
+			e.encodeChecksum(cr)
+		}
+		e.deferred = nil
+	}
+	for i := range c.held {
+		c.held[i] = nil
+	}
+	c.held = c.held[:0]
+}
+
+// measuredLength 返回已经编码的字段的长度，n 是字段编码后的字节数
+// 和 refLength 相同，只是 lengthref 使用的长度按照字段的类型计算
+func measuredLength(c *CodecState, lengthref, target field, tv reflect.Value, n int) int {
+	if lengthref.tagOptions.refUnit != refDefault {
+		return refLength(c, lengthref, target, tv, n)
+	}
+	switch elemKind(target.codec) {
+	case reflect.Slice, reflect.Map:
+		lengthref.tagOptions.refUnit = refCount
+		return refLength(c, lengthref, target, tv, n)
+	}
+	return n
+}
+
+// pendingLength 是解码时交给内层结构体的长度
+type pendingLength struct {
+	path      []string
+	lengthref field
+	length    int
+}
+
+// setCrossLength 把跨结构体的 lengthref 字段解码得到的长度交给指向的字段
+func (sc structCoder) setCrossLength(c *CodecState, f field, length int) {
+	p := f.tagOptions.refPath
+	k := len(c.frames) - 1 - p.up
+	if k < 0 {
+		c.error(&TagErr{fmt.Errorf("lengthref %s has no enclosing struct for %s", f.name, f.tagOptions.lengthref)})
+	}
+	c.frames[k].addLength(c, f, p.down, length)
+}
+
+// addLength 在 frame 对应的结构体中按照 path 查找字段
+// 和编码时一样，指向已经解码的字段时不需要这个长度，路径经过已经解码的结构体时返回 TagErr
+func (frame *decodeFrame) addLength(c *CodecState, lengthref field, path []string, length int) {
+	sc := frame.sc
+	idx := sc.fieldByName(path[0])
+	if idx < 0 {
+		c.error(&TagErr{fmt.Errorf("lengthref %s not fount field %s", lengthref.name, lengthref.tagOptions.lengthref)})
+	}
+	if idx == frame.cur {
+		c.error(&TagErr{fmt.Errorf("lengthref %s is inside its target %s", lengthref.name, lengthref.tagOptions.lengthref)})
+	}
+
+	if len(path) > 1 {
+		if idx < frame.cur {
+			c.error(&TagErr{fmt.Errorf("lengthref %s target %s is decoded before it", lengthref.name, lengthref.tagOptions.lengthref)})
+		}
+		if !isStructCoder(sc.fields.list[idx].codec) {
+			c.error(&TagErr{fmt.Errorf("lengthref %s field %s is not a struct", lengthref.name, path[0])})
+		}
+		if frame.pending == nil {
+			frame.pending = map[int][]pendingLength{}
+		}
+		frame.pending[idx] = append(frame.pending[idx], pendingLength{path[1:], lengthref, length})
+		return
+	}
+	if idx < frame.cur {
+		return
+	}
+	frame.setLength(idx, length)
+	if frame.refs == nil {
+		frame.refs = map[int]field{}
+	}
+	frame.refs[idx] = lengthref
+}
@@ -0,0 +1,38 @@
+package bytecodec
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+// cstringBytes 在编码后的字符串后面添加 0x00 结束符
+// cstring 标签指定了最大长度时，包括结束符在内超过这个长度返回 LengthErr，使用 truncate 标签时截断
+func cstringBytes(c *CodecState, b []byte, str string, to tagOptions) []byte {
+	if bytes.IndexByte(b, 0) >= 0 {
+		c.error(&UnsupportedValueError{reflect.ValueOf(str), fmt.Sprintf("cstring %q contains NUL", str)})
+	}
+	if max := to.cstringMax; max > 0 && len(b)+1 > max {
+		if !to.truncate {
+			c.error(&LengthErr{fmt.Errorf("cstring length %d max length %d", len(b)+1, max)})
+		}
+		b = truncateString(b, str, stringEncoding(to), max-1)
+	}
+	return append(b, 0)
+}
+
+// readCString 读取到 0x00 结束符为止，返回的字节不包括结束符
+// 读取的字节数超过 cstring 标签指定的最大长度时返回 LengthErr，数据结束时还没有读到结束符返回 ErrShortData
+func readCString(c *CodecState, to tagOptions) []byte {
+	var b []byte
+	for n := 1; ; n++ {
+		x := c.ReadByte()
+		if x == 0 {
+			return b
+		}
+		if to.cstringMax > 0 && n >= to.cstringMax {
+			c.error(&LengthErr{fmt.Errorf("cstring longer than max length %d", to.cstringMax)})
+		}
+		b = append(b, x)
+	}
+}
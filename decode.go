@@ -1,6 +1,10 @@
 package bytecodec
 
-import "reflect"
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
 
 // An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
 // (The argument to Unmarshal must be a non-nil pointer.)
@@ -19,19 +23,107 @@ func (e *InvalidUnmarshalError) Error() string {
 	return "bytecodec: Unmarshal(nil " + e.Type.String() + ")"
 }
 
+// UnmarshalOptions 用于配置一次解码调用
+type UnmarshalOptions struct {
+	// ByteOrder 为数值类型字段的默认字节序，为 nil 时使用大端序
+	// 字段上的 le、be 标签和结构体声明的字节序优先于这个设置
+	ByteOrder binary.ByteOrder
+
+	// DisallowTrailingBytes 为 true 时，v 解码完成后还有剩余的字节会返回 *TrailingDataError
+	// 用于发现帧边界错误或者协议版本不一致
+	DisallowTrailingBytes bool
+}
+
+// TrailingDataError 表示严格模式下值解码完成后还有没有读取的字节
+type TrailingDataError struct {
+	Offset int // 剩余字节在输入中的起始位置
+	Count  int // 剩余的字节数
+}
+
+func (e *TrailingDataError) Error() string {
+	return fmt.Sprintf("bytecodec: %d trailing bytes at offset %d", e.Count, e.Offset)
+}
+
+// BoundsError 表示 lengthref、sizeref 限定了字节数的字段没有正好读取这些字节
+// 字段需要读取超出范围的数据时 Read 为 -1，这时 errors.Is(err, ErrShortData) 返回 true
+type BoundsError struct {
+	Length int // 限定的字节数
+	Read   int // 字段读取的字节数
+}
+
+func (e *BoundsError) Error() string {
+	if e.Read < 0 {
+		return fmt.Sprintf("bytecodec: field reads past its %d bytes", e.Length)
+	}
+	return fmt.Sprintf("bytecodec: field reads %d of its %d bytes", e.Read, e.Length)
+}
+
+func (e *BoundsError) Is(target error) bool {
+	return e.Read < 0 && target == ErrShortData
+}
+
 func Unmarshal(data []byte, v interface{}) error {
+	return UnmarshalOptions{}.Unmarshal(data, v)
+}
+
+func (o UnmarshalOptions) Unmarshal(data []byte, v interface{}) error {
+	n, err := o.UnmarshalPrefix(data, v)
+	if err != nil {
+		return err
+	}
+	if o.DisallowTrailingBytes && n < len(data) {
+		return &TrailingDataError{Offset: n, Count: len(data) - n}
+	}
+	return nil
+}
+
+// UnmarshalPrefix 从 data 的开头解码一个值到 v 中，返回读取的字节数，剩余的字节不会作为错误返回
+// data 中连续存放了多个值时，可以循环调用它依次解码
+//
+//	for len(data) > 0 {
+//		n, err := bytecodec.UnmarshalPrefix(data, &p)
+//		...
+//		data = data[n:]
+//	}
+//
+// 出错时返回的 n 为出错前已经读取的字节数
+func UnmarshalPrefix(data []byte, v interface{}) (int, error) {
+	return UnmarshalOptions{}.UnmarshalPrefix(data, v)
+}
+
+// UnmarshalPrefix 和 Unmarshal 使用相同的选项解码 data 开头的一个值，DisallowTrailingBytes 对它无效
+func (o UnmarshalOptions) UnmarshalPrefix(data []byte, v interface{}) (int, error) {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+		return 0, &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
 	d := newCodecState()
+	d.order = o.ByteOrder
 	d.Write(data)
 	err := d.unmarshal(rv)
+	n := len(data) - d.Len()
 	if err != nil {
-		return err
+		return n, err
 	}
 
 	encodeStatePool.Put(d)
-	return nil
+	return n, nil
+}
+
+// UnmarshalPrefix 从 CodecState 剩余的数据中解码一个值到 v 中，返回读取的字节数
+// 用于在自定义 ByteCoder 中解码嵌套的值，解码使用当前的字节序，出错时返回错误而不是中止外层的解码
+func (c *CodecState) UnmarshalPrefix(v interface{}) (int, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return 0, &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+	if c.pt == nil {
+		pt := newPointerTrack()
+		c.pt = &pt
+	}
+
+	off := c.off
+	err := c.unmarshal(rv)
+	return c.off - off, err
 }
@@ -1,7 +1,21 @@
 package bytecodec
 
+import "encoding/binary"
+
+// MarshalOptions 用于配置一次编码调用
+type MarshalOptions struct {
+	// ByteOrder 为数值类型字段的默认字节序，为 nil 时使用大端序
+	// 字段上的 le、be 标签和结构体声明的字节序优先于这个设置
+	ByteOrder binary.ByteOrder
+}
+
 func Marshal(v interface{}) ([]byte, error) {
+	return MarshalOptions{}.Marshal(v)
+}
+
+func (o MarshalOptions) Marshal(v interface{}) ([]byte, error) {
 	e := newCodecState()
+	e.order = o.ByteOrder
 
 	err := e.marshal(v)
 	if err != nil {
@@ -0,0 +1,97 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldError 表示编解码结构体字段时出现的错误，Err 是原始的错误，可以使用 errors.Is errors.As 判断
+type FieldError struct {
+	Path   string       // 以 . 分隔的字段路径，第一段是最外层结构体的类型名，例如 Packet.Header.Time
+	Type   reflect.Type // 字段的类型
+	Offset int          // 字段在输入（解码）或输出（编码）中的起始位置
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("bytecodec: field %s (%s) at offset %d: %v", e.Path, e.Type, e.Offset, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// pathEntry 是正在编解码的结构体字段
+type pathEntry struct {
+	name   string
+	typ    reflect.Type
+	offset int
+}
+
+func (c *CodecState) pushPath(name string, typ reflect.Type, offset int) {
+	c.path = append(c.path, pathEntry{name, typ, offset})
+}
+
+func (c *CodecState) popPath() {
+	c.path = c.path[:len(c.path)-1]
+}
+
+// decodeOffset encodeOffset 返回当前在整个输入或输出中的位置
+// 子 CodecState 的 base 是它的数据在外层中的起始位置
+func (c *CodecState) decodeOffset() int {
+	return c.base + c.off
+}
+
+func (c *CodecState) encodeOffset() int {
+	return c.base + c.Len()
+}
+
+// fieldError 使用正在编解码的字段路径包装 err，已经包装过的错误不会重复包装
+func (c *CodecState) fieldError(err error) error {
+	if len(c.path) == 0 {
+		return err
+	}
+	if _, ok := err.(*FieldError); ok {
+		return err
+	}
+	names := make([]string, len(c.path))
+	for i, p := range c.path {
+		names[i] = p.name
+	}
+	last := c.path[len(c.path)-1]
+	return &FieldError{Path: strings.Join(names, "."), Type: last.typ, Offset: last.offset, Err: err}
+}
+
+// refError 使用 e 中 lengthref 字段 i 的路径和位置包装 err
+// 回填 lengthref 时 c.path 是指向的字段的路径，错误需要指向 lengthref 字段
+func (e *structEncoder) refError(i int, err error) error {
+	path := e.path
+	if path == nil {
+		path = e.c.path[:e.depth]
+	}
+	names := make([]string, 0, len(path)+1)
+	for _, p := range path {
+		names = append(names, p.name)
+	}
+	f := e.sc.fields.list[i]
+	return &FieldError{
+		Path:   strings.Join(append(names, f.name), "."),
+		Type:   e.v.Field(f.index).Type(),
+		Offset: e.c.base + e.pos[i],
+		Err:    err,
+	}
+}
+
+// rootName 返回 FieldError 路径的第一段，v 不是命名的结构体类型时为空
+func rootName(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	t := v.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	return t.Name()
+}
@@ -0,0 +1,193 @@
+package bytecodec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrInvalidFrame 表示帧的分隔符或者转义序列不正确
+var ErrInvalidFrame = errors.New("bytecodec: invalid frame")
+
+// Framer 实现使用分隔符和转义字节的帧格式，例如 JT/T 808 使用 0x7e 作为帧的开始和结束，
+// 帧内的 0x7e 转义为 0x7d 0x02，0x7d 转义为 0x7d 0x01
+//
+// Framer 第一次还原转义时根据 Table 建立反向的映射，之后不应该再修改 Table，也不应该复制使用过的 Framer
+type Framer struct {
+	Delim byte          // 帧的开始和结束标记
+	Esc   byte          // 转义字节
+	Table map[byte]byte // 需要转义的字节 -> 写在 Esc 之后的字节，Delim 和 Esc 都应该包含在内
+
+	// MarshalOptions UnmarshalOptions 用于 Marshal Unmarshal 以及 FrameWriter FrameReader 编解码帧中的数据
+	MarshalOptions   MarshalOptions
+	UnmarshalOptions UnmarshalOptions
+
+	once    sync.Once
+	reverse map[byte]byte // 写在 Esc 之后的字节 -> 转义前的字节
+}
+
+// JT808Framer 是 JT/T 808 协议使用的帧格式
+var JT808Framer = &Framer{
+	Delim: 0x7e,
+	Esc:   0x7d,
+	Table: map[byte]byte{0x7e: 0x02, 0x7d: 0x01},
+}
+
+// Escape 转义 b 中需要转义的字节，不添加分隔符
+func (f *Framer) Escape(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		if e, ok := f.Table[c]; ok {
+			out = append(out, f.Esc, e)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Unescape 还原 Escape 转义过的数据
+func (f *Framer) Unescape(b []byte) ([]byte, error) {
+	f.once.Do(func() {
+		f.reverse = make(map[byte]byte, len(f.Table))
+		for k, v := range f.Table {
+			f.reverse[v] = k
+		}
+	})
+
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != f.Esc {
+			out = append(out, b[i])
+			continue
+		}
+		if i+1 >= len(b) {
+			return nil, fmt.Errorf("%w: truncated escape sequence at offset %d", ErrInvalidFrame, i)
+		}
+		c, ok := f.reverse[b[i+1]]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid escape sequence %#x %#x at offset %d", ErrInvalidFrame, b[i], b[i+1], i)
+		}
+		out = append(out, c)
+		i++
+	}
+	return out, nil
+}
+
+// Wrap 转义 payload 并在前后添加分隔符
+func (f *Framer) Wrap(payload []byte) []byte {
+	out := append([]byte{f.Delim}, f.Escape(payload)...)
+	return append(out, f.Delim)
+}
+
+// Unwrap 去掉 frame 前后的分隔符并还原转义
+func (f *Framer) Unwrap(frame []byte) ([]byte, error) {
+	if len(frame) < 2 || frame[0] != f.Delim || frame[len(frame)-1] != f.Delim {
+		return nil, fmt.Errorf("%w: missing delimiter %#x", ErrInvalidFrame, f.Delim)
+	}
+	body := frame[1 : len(frame)-1]
+	if bytes.IndexByte(body, f.Delim) >= 0 {
+		return nil, fmt.Errorf("%w: unexpected delimiter %#x in frame", ErrInvalidFrame, f.Delim)
+	}
+	return f.Unescape(body)
+}
+
+// Marshal 编码 v 并封装为一帧
+func (f *Framer) Marshal(v interface{}) ([]byte, error) {
+	b, err := f.MarshalOptions.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return f.Wrap(b), nil
+}
+
+// Unmarshal 解开一帧并把其中的数据解码到 v 中
+func (f *Framer) Unmarshal(frame []byte, v interface{}) error {
+	b, err := f.Unwrap(frame)
+	if err != nil {
+		return err
+	}
+	return f.UnmarshalOptions.Unmarshal(b, v)
+}
+
+// A FrameReader reads frames from an input stream.
+type FrameReader struct {
+	f    *Framer
+	r    *bufio.Reader
+	open bool // 上一帧的结束分隔符同时作为下一帧的开始
+}
+
+// NewReader returns a FrameReader that reads frames from r.
+// FrameReader 内部有缓冲，会预读 r 中的数据
+func (f *Framer) NewReader(r io.Reader) *FrameReader {
+	return &FrameReader{f: f, r: bufio.NewReader(r)}
+}
+
+// ReadFrame 读取下一帧，返回还原转义后的数据，第一帧开始分隔符之前的数据会被丢弃
+// 前一帧的结束分隔符同时作为后一帧的开始，所以 7e A 7e B 7e 会依次返回 A 和 B
+// 连续的两个分隔符被看作前一帧的结束和后一帧的开始，不会返回空帧
+// 流中没有更多帧时返回 io.EOF
+func (fr *FrameReader) ReadFrame() ([]byte, error) {
+	if !fr.open {
+		if _, err := fr.r.ReadBytes(fr.f.Delim); err != nil {
+			return nil, err
+		}
+		fr.open = true
+	}
+	for {
+		b, err := fr.r.ReadBytes(fr.f.Delim)
+		if err == io.EOF {
+			fr.open = false
+			if len(b) == 0 {
+				return nil, io.EOF
+			}
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(b) == 1 {
+			// 空帧，把这个分隔符当作下一帧的开始
+			continue
+		}
+		return fr.f.Unescape(b[:len(b)-1])
+	}
+}
+
+// Decode 读取下一帧并把其中的数据解码到 v 中
+func (fr *FrameReader) Decode(v interface{}) error {
+	b, err := fr.ReadFrame()
+	if err != nil {
+		return err
+	}
+	return fr.f.UnmarshalOptions.Unmarshal(b, v)
+}
+
+// A FrameWriter writes frames to an output stream.
+type FrameWriter struct {
+	f *Framer
+	w io.Writer
+}
+
+// NewWriter returns a FrameWriter that writes frames to w.
+func (f *Framer) NewWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{f: f, w: w}
+}
+
+// WriteFrame 把 payload 封装为一帧写入到流中
+func (fw *FrameWriter) WriteFrame(payload []byte) error {
+	_, err := fw.w.Write(fw.f.Wrap(payload))
+	return err
+}
+
+// Encode 编码 v 并封装为一帧写入到流中
+func (fw *FrameWriter) Encode(v interface{}) error {
+	b, err := fw.f.MarshalOptions.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return fw.WriteFrame(b)
+}
@@ -0,0 +1,151 @@
+package bytecodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+type framedMessage struct {
+	ID   uint16
+	Body []byte
+}
+
+func TestFramerWrap(t *testing.T) {
+	payload := []byte{0x30, 0x7e, 0x08, 0x7d, 0x55}
+	frame := []byte{0x7e, 0x30, 0x7d, 0x02, 0x08, 0x7d, 0x01, 0x55, 0x7e}
+
+	if got := JT808Framer.Wrap(payload); !reflect.DeepEqual(got, frame) {
+		t.Errorf("Wrap %#v = %#v, want %#v", payload, got, frame)
+	}
+	got, err := JT808Framer.Unwrap(frame)
+	if err != nil {
+		t.Fatalf("Unwrap %#v, unexpected error: %s", frame, err)
+	}
+	if !reflect.DeepEqual(got, payload) {
+		t.Errorf("Unwrap %#v = %#v, want %#v", frame, got, payload)
+	}
+}
+
+func TestFramerUnwrapInvalid(t *testing.T) {
+	frames := [][]byte{
+		{0x30, 0x7e},
+		{0x7e, 0x30, 0x7d, 0x03, 0x7e},
+		{0x7e, 0x30, 0x7d, 0x7e},
+		{0x7e, 0x30, 0x7e, 0x31, 0x7e},
+	}
+	for _, frame := range frames {
+		if _, err := JT808Framer.Unwrap(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("Unwrap %#v error = %v, want ErrInvalidFrame", frame, err)
+		}
+	}
+}
+
+func TestFramerMarshalUnmarshal(t *testing.T) {
+	v := &framedMessage{ID: 0x7e7d, Body: []byte{0x1, 0x7e}}
+	frame := []byte{0x7e, 0x7d, 0x02, 0x7d, 0x01, 0x1, 0x7d, 0x02, 0x7e}
+
+	b, err := JT808Framer.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal %#v, unexpected error: %s", v, err)
+	}
+	if !reflect.DeepEqual(b, frame) {
+		t.Errorf("Marshal %#v = %#v, want %#v", v, b, frame)
+	}
+
+	out := &framedMessage{}
+	if err := JT808Framer.Unmarshal(frame, out); err != nil {
+		t.Fatalf("Unmarshal %#v, unexpected error: %s", frame, err)
+	}
+	if !reflect.DeepEqual(out, v) {
+		t.Errorf("Unmarshal %#v = %#v, want %#v", frame, out, v)
+	}
+}
+
+func TestFramerOptions(t *testing.T) {
+	f := &Framer{
+		Delim:            0x7e,
+		Esc:              0x7d,
+		Table:            map[byte]byte{0x7e: 0x02, 0x7d: 0x01},
+		MarshalOptions:   MarshalOptions{ByteOrder: binary.LittleEndian},
+		UnmarshalOptions: UnmarshalOptions{ByteOrder: binary.LittleEndian, DisallowTrailingBytes: true},
+	}
+	v := &framedMessage{ID: 0x017e}
+	frame := []byte{0x7e, 0x7d, 0x02, 0x01, 0x7e}
+
+	b, err := f.Marshal(v)
+	if err != nil || !reflect.DeepEqual(b, frame) {
+		t.Errorf("Marshal %#v = %#v, %v, want %#v", v, b, err, frame)
+	}
+	var buf bytes.Buffer
+	if err := f.NewWriter(&buf).Encode(v); err != nil || !reflect.DeepEqual(buf.Bytes(), frame) {
+		t.Errorf("Encode %#v = %#v, %v, want %#v", v, buf.Bytes(), err, frame)
+	}
+
+	out := &framedMessage{}
+	if err := f.NewReader(&buf).Decode(out); err != nil || !reflect.DeepEqual(out, &framedMessage{ID: 0x017e, Body: []byte{}}) {
+		t.Errorf("Decode = %#v, %v, want ID 0x17e", out, err)
+	}
+	var te *TrailingDataError
+	if err := f.Unmarshal([]byte{0x7e, 0x1, 0x7e}, &struct{ ID uint8 }{}); err != nil {
+		t.Errorf("Unmarshal unexpected error: %s", err)
+	}
+	if err := f.Unmarshal([]byte{0x7e, 0x1, 0x2, 0x7e}, &struct{ ID uint8 }{}); !errors.As(err, &te) {
+		t.Errorf("Unmarshal trailing byte got error %v, want TrailingDataError", err)
+	}
+}
+
+func TestFrameReaderWriter(t *testing.T) {
+	values := []*framedMessage{
+		{ID: 1, Body: []byte{0x7e}},
+		{ID: 2, Body: []byte{0x7d, 0x0}},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("garbage")
+	fw := JT808Framer.NewWriter(&buf)
+	for _, v := range values {
+		if err := fw.Encode(v); err != nil {
+			t.Fatalf("Encode %#v, unexpected error: %s", v, err)
+		}
+	}
+
+	fr := JT808Framer.NewReader(&buf)
+	for _, want := range values {
+		out := &framedMessage{}
+		if err := fr.Decode(out); err != nil {
+			t.Fatalf("Decode unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("Decode = %#v, want %#v", out, want)
+		}
+	}
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("ReadFrame at end of stream = %v, want io.EOF", err)
+	}
+}
+
+func TestFrameReaderSharedDelim(t *testing.T) {
+	// 相邻的帧共用一个分隔符
+	fr := JT808Framer.NewReader(bytes.NewReader([]byte{0x7e, 0x1, 0x7e, 0x2, 0x7d, 0x2, 0x7e, 0x7e, 0x3, 0x7e}))
+	for _, want := range [][]byte{{0x1}, {0x2, 0x7e}, {0x3}} {
+		b, err := fr.ReadFrame()
+		if err != nil || !bytes.Equal(b, want) {
+			t.Fatalf("ReadFrame = %#v, %v, want %#v", b, err, want)
+		}
+	}
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Errorf("ReadFrame at end of stream = %v, want io.EOF", err)
+	}
+
+	fr = JT808Framer.NewReader(bytes.NewReader([]byte{0x7e, 0x1, 0x7e, 0x2}))
+	if _, err := fr.ReadFrame(); err != nil {
+		t.Fatalf("ReadFrame unexpected error: %s", err)
+	}
+	if _, err := fr.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFrame truncated frame = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,152 @@
+package bytecodec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// 这个文件中的导出方法主要供 bytecodecgen 生成的代码使用，自定义 ByteCoder 也可以使用
+// 和 ReadFull、ReadByte 一样，出错时它们不返回错误，而是中止这次 Marshal 或 Unmarshal 调用并返回错误
+// 所以只能在 bytecodec 调用的 MarshalBytes、UnmarshalBytes 中使用
+
+// FieldTag 是解析后的 bytecodec 标签，生成的代码在包级变量中保存它，避免重复解析
+type FieldTag struct {
+	to tagOptions
+}
+
+// ParseFieldTag 解析字段的 bytecodec 标签
+func ParseFieldTag(tag string) FieldTag {
+	return FieldTag{parseTag(tag)}
+}
+
+// CheckBounded 在流式解码时检查 slice 等读取全部剩余数据的字段是否有长度，length 小于 0 时返回 ErrUnbounded
+func (c *CodecState) CheckBounded(length int) {
+	if length < 0 {
+		c.unbounded()
+	}
+}
+
+// More 返回是否还有未读取的数据，流式解码时可能会阻塞等待数据
+func (c *CodecState) More() bool {
+	return c.more()
+}
+
+// StructByteOrder 设置结构体声明的字节序，返回结构体字段默认使用的字节序
+// order 为 nil 或者外层字段通过标签指定了字节序时，不修改当前的字节序
+// 字节序会在 MarshalBytes、UnmarshalBytes 返回后恢复
+func (c *CodecState) StructByteOrder(order binary.ByteOrder) binary.ByteOrder {
+	if order != nil && !c.tagOrder {
+		c.order = order
+	}
+	return c.ByteOrder()
+}
+
+// StringBytes 按照标签编码字符串，返回编码后的字节，不写入 CodecState
+func (c *CodecState) StringBytes(s string, tag FieldTag) []byte {
+	return stringBytes(c, s, tag.to)
+}
+
+// DecodeString 按照标签解码字符串，length 大于等于 0 时表示 lengthref 得到的字节长度，优先于标签
+// 长度为 0 时不修改 s
+func (c *CodecState) DecodeString(s *string, tag FieldTag, length int) {
+	to := tag.to
+	if to.bcd8421 != 0 {
+		to.length = to.bcd8421
+	}
+	if length >= 0 {
+		to.length = length
+	}
+	if str, ok := decodeString(c, to); ok {
+		*s = str
+	}
+}
+
+// EncodeField 按照标签编码任意类型的值
+func (c *CodecState) EncodeField(v interface{}, tag FieldTag) {
+	rv := reflect.ValueOf(v)
+	valueCodec(rv).encode(c, rv, tag.to)
+}
+
+// FieldBytes 按照标签编码任意类型的值，返回编码后的字节和 lengthref 使用的长度，不写入 CodecState
+func (c *CodecState) FieldBytes(v interface{}, tag FieldTag) ([]byte, int) {
+	scc := c.gensub()
+	scc.base += c.Len()
+	scc.EncodeField(v, tag)
+	b := append([]byte(nil), scc.Bytes()...)
+	length := encodedLength(scc, scc.Len())
+	encodeStatePool.Put(scc)
+	return b, length
+}
+
+// DecodeField 按照标签解码任意类型的值，ptr 必须是指针
+// length 大于等于 0 时表示 lengthref 得到的长度，和结构体字段的处理方式相同
+func (c *CodecState) DecodeField(ptr interface{}, tag FieldTag, length int) {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		c.error(&InvalidUnmarshalError{reflect.TypeOf(ptr)})
+	}
+	v := rv.Elem()
+	cd := typeCodec(v.Type())
+
+	to := tag.to
+	if to.bcd8421 != 0 {
+		to.length = to.bcd8421
+	}
+	if length >= 0 {
+		to.length = length
+		if !handlesLength(cd) {
+			decodeBounded(c, cd, v, to)
+			return
+		}
+	}
+	cd.decode(c, v, to)
+}
+
+// RefLength 把解码得到的有符号 lengthref 字段的值转换为长度
+// 值为负数时返回 LengthErr，超出 int 的范围时返回 OverflowError，和反射的处理方式相同
+func (c *CodecState) RefLength(field string, n int64) int {
+	if n < 0 {
+		c.error(&LengthErr{fmt.Errorf("lengthref %s value %d gives negative length %d", field, n, n)})
+	}
+	if overflowsInt(n, strconv.IntSize, true) {
+		c.error(&OverflowError{Field: field, Width: strconv.IntSize, Value: n})
+	}
+	return int(n)
+}
+
+// RefLengthUint 把解码得到的无符号 lengthref 字段的值转换为长度，超出 int 的范围时返回 OverflowError
+func (c *CodecState) RefLengthUint(field string, u uint64) int {
+	if u > uint64(maxInt) {
+		c.error(&OverflowError{Field: field, Width: strconv.IntSize, Value: u})
+	}
+	return int(u)
+}
+
+// RefLengthFloat 把解码得到的浮点数 lengthref 字段的值转换为长度，小数部分被舍去
+// 值为负数时返回 LengthErr，超出 int 的范围或者为 NaN 时返回 OverflowError
+func (c *CodecState) RefLengthFloat(field string, f float64) int {
+	if f < 0 {
+		c.error(&LengthErr{fmt.Errorf("lengthref %s value %v gives negative length %v", field, f, f)})
+	}
+	if math.IsNaN(f) || f >= float64(maxInt) {
+		c.error(&OverflowError{Field: field, Width: strconv.IntSize, Value: f})
+	}
+	return int(f)
+}
+
+// CheckFloat 检查浮点数能否编码，bitSize 为 32 或 64
+func (c *CodecState) CheckFloat(f float64, bitSize int) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		c.error(&UnsupportedValueError{reflect.ValueOf(f), strconv.FormatFloat(f, 'g', -1, bitSize)})
+	}
+}
+
+// CheckLength 检查 slice 的元素个数和 length 标签是否一致
+func (c *CodecState) CheckLength(n, length int) {
+	if length > 0 && n != length {
+		c.error(&LengthErr{fmt.Errorf("slice length %d tag length %d", n, length)})
+	}
+}
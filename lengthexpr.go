@@ -0,0 +1,166 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// lengthExpr 是 length 标签中引用其他字段的长度表达式，例如 TotalLen-12、IHL*4-20
+// 表示这个字段的长度 = 字段 field 的值 * scale + offset
+type lengthExpr struct {
+	field  string
+	scale  int
+	offset int
+}
+
+func parseLengthExpr(expr string) (*lengthExpr, error) {
+	e := &lengthExpr{scale: 1}
+	rest := strings.TrimSpace(expr)
+	if i := strings.IndexAny(rest, "+-"); i >= 0 {
+		offset, err := strconv.Atoi(strings.TrimSpace(rest[i:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid length expression %q: %v", expr, err)
+		}
+		e.offset = offset
+		rest = strings.TrimSpace(rest[:i])
+	}
+	if i := strings.Index(rest, "*"); i >= 0 {
+		scale, err := strconv.Atoi(strings.TrimSpace(rest[i+1:]))
+		if err != nil || scale <= 0 {
+			return nil, fmt.Errorf("invalid length expression %q: invalid scale", expr)
+		}
+		e.scale = scale
+		rest = strings.TrimSpace(rest[:i])
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("invalid length expression %q: missing field", expr)
+	}
+	e.field = rest
+	return e, nil
+}
+
+// parseLengthref 解析 lengthref 标签，例如 lengthref:Body、lengthref:Body,scale:4,adjust:+8、lengthref:Header..Body、lengthref:^.Body
+// 逗号后面只能是 scale、adjust 选项，它们也可以写成单独的标签 lengthref:Body;scale:4，这时从 settings 中读取
+func parseLengthref(to *tagOptions, ref string, settings map[string]string) error {
+	params := strings.Split(ref, ",")
+	to.lengthref = params[0]
+	if i := strings.Index(to.lengthref, ".."); i >= 0 {
+		to.lengthref, to.refSpanEnd = to.lengthref[:i], to.lengthref[i+2:]
+	}
+	if strings.Contains(to.lengthref, ".") || strings.Contains(to.refSpanEnd, ".") {
+		if to.refSpanEnd != "" {
+			return fmt.Errorf("lengthref %s span can not use a field path", ref)
+		}
+		var err error
+		if to.refPath, err = parseRefPath(to.lengthref); err != nil {
+			return err
+		}
+	}
+	options := map[string]string{}
+	for _, name := range []string{"scale", "adjust"} {
+		if v, ok := settings[name]; ok {
+			options[name] = v
+		}
+	}
+	for _, param := range params[1:] {
+		s := strings.SplitN(param, ":", 2)
+		if len(s) < 2 {
+			return fmt.Errorf("lengthref %s option %q is invalid", ref, param)
+		}
+		if s[0] != "scale" && s[0] != "adjust" {
+			return fmt.Errorf("lengthref %s option %q is unknown", ref, s[0])
+		}
+		options[s[0]] = s[1]
+	}
+	to.refScale = 1
+	if scale, ok := options["scale"]; ok {
+		n, err := strconv.Atoi(scale)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("lengthref %s scale %q is invalid", ref, scale)
+		}
+		to.refScale = n
+	}
+	if adjust, ok := options["adjust"]; ok {
+		n, err := strconv.Atoi(adjust)
+		if err != nil {
+			return fmt.Errorf("lengthref %s adjust %q is invalid", ref, adjust)
+		}
+		to.refAdjust = n
+	}
+	return nil
+}
+
+// resolveLengthExprs 把 length 标签中的长度表达式转换为被引用字段上的 lengthref
+// 字段 A 的 length:B*s+o 和字段 B 的 lengthref:A,scale:s,adjust:-o 相同
+func resolveLengthExprs(fields []field) {
+	for i := range fields {
+		expr := fields[i].tagOptions.lengthExpr
+		if expr == nil {
+			continue
+		}
+		found := false
+		for j := range fields {
+			if fields[j].name != expr.field {
+				continue
+			}
+			found = true
+			to := &fields[j].tagOptions
+			if to.lengthref != "" && to.lengthref != fields[i].name {
+				fields[i].tagOptions.lengthErr = fmt.Errorf("length %s field %s is already a lengthref of %s", fields[i].name, expr.field, to.lengthref)
+				break
+			}
+			to.lengthref = fields[i].name
+			to.refScale = expr.scale
+			to.refAdjust = -expr.offset
+		}
+		if !found {
+			fields[i].tagOptions.lengthErr = fmt.Errorf("length %s not fount field %s", fields[i].name, expr.field)
+		}
+	}
+}
+
+// scaledLength 按照 lengthref 的 scale、adjust 把字段的长度转换为 lengthref 字段写入的值
+func scaledLength(lengthref field, length int) (int, error) {
+	to := lengthref.tagOptions
+	length += to.refAdjust
+	if length < 0 {
+		return 0, &LengthErr{fmt.Errorf("lengthref %s adjusted length %d is negative", lengthref.name, length)}
+	}
+	if to.refScale > 1 {
+		if length%to.refScale != 0 {
+			return 0, &LengthErr{fmt.Errorf("lengthref %s length %d is not a multiple of scale %d", lengthref.name, length, to.refScale)}
+		}
+		length /= to.refScale
+	}
+	return length, nil
+}
+
+// unscaledLength 按照 lengthref 的 scale、adjust 把解码得到的 lengthref 字段的值转换为字段的长度
+func unscaledLength(c *CodecState, lengthref field, value int) int {
+	to := lengthref.tagOptions
+	if to.refScale > 1 {
+		if value > maxInt/to.refScale {
+			c.error(&OverflowError{Field: lengthref.name, Width: strconv.IntSize, Value: int64(value)})
+		}
+		value *= to.refScale
+	}
+	if to.refAdjust < 0 && value > maxInt+to.refAdjust {
+		c.error(&OverflowError{Field: lengthref.name, Width: strconv.IntSize, Value: int64(value)})
+	}
+	length := value - to.refAdjust
+	if length < 0 {
+		c.error(&LengthErr{fmt.Errorf("lengthref %s value %d gives negative length %d", lengthref.name, value, length)})
+	}
+	return length
+}
+
+// refValue 返回 lengthref 字段需要写入的值
+func refValue(lengthref field, length int) (reflect.Value, error) {
+	n, err := scaledLength(lengthref, length)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return lengthValue(lengthref, n)
+}
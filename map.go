@@ -0,0 +1,106 @@
+package bytecodec
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// mapCoder 把 map 编码为连续的键值对，编码时按照键排序，保证结果确定
+// lengthref 和 length 标签表示键值对的个数
+type mapCoder struct {
+	keyCodec, elemCodec codec
+}
+
+func (mapCoder) typ() reflect.Kind {
+	return reflect.Map
+}
+
+// elemOptions 返回键或值使用的标签，通过 key.、value. 前缀指定的标签之外，继承 map 字段的字节序和 wrap 标签
+func (mapCoder) elemOptions(to tagOptions, opts *tagOptions) tagOptions {
+	eo := tagOptions{length: -1}
+	if opts != nil {
+		eo = *opts
+	}
+	if eo.byteOrder == nil {
+		eo.byteOrder = to.byteOrder
+	}
+	eo.wrap = eo.wrap || to.wrap
+	return eo
+}
+
+type mapEntry struct {
+	key reflect.Value
+	kb  []byte // 编码后的键
+}
+
+func (mc mapCoder) encode(c *CodecState, v reflect.Value, to tagOptions) {
+	n := v.Len()
+	if to.length > 0 && n != to.length {
+		c.error(&LengthErr{fmt.Errorf("map length %d tag length %d", n, to.length)})
+	}
+
+	keyOpts := mc.elemOptions(to, to.mapKey)
+	elemOpts := mc.elemOptions(to, to.mapValue)
+
+	entries := make([]mapEntry, 0, n)
+	iter := v.MapRange()
+	for iter.Next() {
+		scc := c.gensub()
+		scc.base += c.Len()
+		mc.keyCodec.encode(scc, iter.Key(), keyOpts)
+		entries = append(entries, mapEntry{iter.Key(), append([]byte(nil), scc.Bytes()...)})
+		encodeStatePool.Put(scc)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return lessMapKey(entries[i], entries[j])
+	})
+
+	for _, e := range entries {
+		c.Write(e.kb)
+		mc.elemCodec.encode(c, v.MapIndex(e.key), elemOpts)
+	}
+	c.set("length", n)
+}
+
+// lessMapKey 整数、浮点数、string、bool 类型的键按照值排序，其他类型按照编码后的字节排序
+func lessMapKey(a, b mapEntry) bool {
+	switch a.key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.key.Int() < b.key.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.key.Uint() < b.key.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.key.Float() < b.key.Float()
+	case reflect.String:
+		return a.key.String() < b.key.String()
+	case reflect.Bool:
+		return !a.key.Bool() && b.key.Bool()
+	}
+	return bytes.Compare(a.kb, b.kb) < 0
+}
+
+func (mc mapCoder) decode(c *CodecState, v reflect.Value, to tagOptions) {
+	keyOpts := mc.elemOptions(to, to.mapKey)
+	elemOpts := mc.elemOptions(to, to.mapValue)
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	if to.length < 0 {
+		c.unbounded()
+	}
+	t := v.Type()
+	for i := 0; (to.length < 0 || i < to.length) && c.more(); i++ {
+		key := reflect.New(t.Key()).Elem()
+		mc.keyCodec.decode(c, key, keyOpts)
+		elem := reflect.New(t.Elem()).Elem()
+		mc.elemCodec.decode(c, elem, elemOpts)
+		v.SetMapIndex(key, elem)
+	}
+}
+
+func newMapCoder(t reflect.Type) codec {
+	return mapCoder{typeCodec(t.Key()), typeCodec(t.Elem())}
+}
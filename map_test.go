@@ -0,0 +1,66 @@
+package bytecodec
+
+import "testing"
+
+type mapTag struct {
+	Count uint8             `bytecodec:"lengthref:Attrs"`
+	Attrs map[uint16]uint32 `bytecodec:"le"`
+	Names map[string]string `bytecodec:"length:2;key.length:2;value.gbk;value.length:4"`
+	Flags map[int8]bool
+}
+
+type structKeyMap struct {
+	Struct map[Small]uint8
+}
+
+var mapTests = []testcase{{
+	[]byte{
+		0x3,
+		0x1, 0x0, 0x1, 0x0, 0x0, 0x0,
+		0x2, 0x0, 0x2, 0x0, 0x0, 0x0,
+		0x10, 0x0, 0x10, 0x0, 0x0, 0x0,
+		0x61, 0x62, 0xb2, 0xe2, 0xca, 0xd4,
+		0x62, 0x63, 0x61, 0x62, 0x63, 0x64,
+		0xff, 0x1,
+		0x1, 0x0,
+	},
+	&mapTag{},
+	&mapTag{
+		Count: 3,
+		Attrs: map[uint16]uint32{0x10: 0x10, 1: 1, 2: 2},
+		Names: map[string]string{"bc": "abcd", "ab": "测试"},
+		Flags: map[int8]bool{1: false, -1: true},
+	},
+}, {
+	[]byte{
+		0x73, 0x6d, 0x61, 0x6c, 0x6c, 0x2,
+		0x74, 0x61, 0x67, 0x32, 0x30, 0x1,
+	},
+	&structKeyMap{},
+	&structKeyMap{
+		Struct: map[Small]uint8{{"tag20"}: 1, {"small"}: 2},
+	},
+}}
+
+func TestMap(t *testing.T) {
+	testMarshalUnmarshal(t, mapTests)
+}
+
+type mapByteOrder struct {
+	Attrs map[uint16]uint32 `bytecodec:"le;length:1;value.length:4"`
+	Keys  map[uint16]uint16 `bytecodec:"le;length:1;key.be"`
+}
+
+func TestMapInheritByteOrder(t *testing.T) {
+	testMarshalUnmarshal(t, []testcase{{
+		[]byte{
+			0x1, 0x0, 0x2, 0x0, 0x0, 0x0,
+			0x0, 0x3, 0x4, 0x0,
+		},
+		&mapByteOrder{},
+		&mapByteOrder{
+			Attrs: map[uint16]uint32{1: 2},
+			Keys:  map[uint16]uint16{3: 4},
+		},
+	}})
+}
@@ -0,0 +1,75 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// OverflowError 表示值超出了字段能够表示的范围，例如 300 字节的 string 使用 uint8 类型的 lengthref
+// 字段使用 wrap 标签时只保留值的低位，不返回这个错误，用于有意截断长度的协议
+type OverflowError struct {
+	Field string      // 字段名
+	Width int         // 字段的位数
+	Value interface{} // 超出范围的值，int64、uint64，浮点数 lengthref 字段的值为 float64
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("bytecodec: value %v overflows %d bits of field %s", e.Value, e.Width, e.Field)
+}
+
+// overflowsInt 返回 n 是否超出 width 位的整数的范围，signed 表示有符号整数
+func overflowsInt(n int64, width int, signed bool) bool {
+	if signed {
+		return width < 64 && (n < -1<<uint(width-1) || n >= 1<<uint(width-1))
+	}
+	return n < 0 || width < 64 && uint64(n) >= 1<<uint(width)
+}
+
+// overflowsUint 返回 u 是否超出 width 位的无符号整数的范围
+func overflowsUint(u uint64, width int) bool {
+	return width < 64 && u >= 1<<uint(width)
+}
+
+// intWidth 返回整数字段的位数，使用 bits 标签时为比特数，不是整数时 ok 为 false
+func intWidth(f field) (width int, signed, ok bool) {
+	switch f.codec.typ() {
+	case reflect.Int8:
+		width, signed = 8, true
+	case reflect.Int16:
+		width, signed = 16, true
+	case reflect.Int32:
+		width, signed = 32, true
+	case reflect.Int, reflect.Int64:
+		width, signed = 64, true
+	case reflect.Uint8:
+		width = 8
+	case reflect.Uint16:
+		width = 16
+	case reflect.Uint32:
+		width = 32
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		width = 64
+	default:
+		return 0, false, false
+	}
+	if f.tagOptions.bits > 0 {
+		width = f.tagOptions.bits
+	}
+	return width, signed, true
+}
+
+// fieldName 返回正在编解码的字段名，不在结构体中时为空
+func (c *CodecState) fieldName() string {
+	if len(c.path) == 0 {
+		return ""
+	}
+	return c.path[len(c.path)-1].name
+}
+
+// CheckOverflow 检查 n 能否使用 width 位的整数表示，signed 表示有符号整数，超出范围时返回 OverflowError
+// 生成的代码使用它检查 lengthref 字段的值，字段使用了 wrap 标签时不需要调用
+func (c *CodecState) CheckOverflow(field string, n int64, width int, signed bool) {
+	if overflowsInt(n, width, signed) {
+		c.error(&OverflowError{Field: field, Width: width, Value: n})
+	}
+}
@@ -0,0 +1,76 @@
+package bytecodec
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+)
+
+// checkStringTags 检查字符串使用的标签，标签不正确时返回 TagErr
+func checkStringTags(c *CodecState, to tagOptions) {
+	if to.padErr != nil {
+		c.error(&TagErr{to.padErr})
+	}
+	if to.cstringErr != nil {
+		c.error(&TagErr{to.cstringErr})
+	}
+}
+
+// fitString 使编码后的字符串符合 length 标签的长度
+// 超过长度时，使用 truncate 标签会在字符边界截断；不足长度时，使用 pad 标签会填充到指定长度
+func fitString(c *CodecState, b []byte, str string, to tagOptions) []byte {
+	if to.length <= 0 {
+		return b
+	}
+	if len(b) > to.length && to.truncate {
+		b = truncateString(b, str, stringEncoding(to), to.length)
+	}
+	if len(b) < to.length && to.pad {
+		padding := bytes.Repeat([]byte{to.padByte}, to.length-len(b))
+		if to.padLeft {
+			b = append(padding, b...)
+		} else {
+			b = append(b, padding...)
+		}
+	}
+	if len(b) != to.length {
+		c.error(&LengthErr{fmt.Errorf("string length %d tag length %d", len(b), to.length)})
+	}
+	return b
+}
+
+// truncateString 截断编码后超过 length 字节的字符串，不会截断多字节字符，所以结果可能比 length 短
+func truncateString(b []byte, str string, enc encoding.Encoding, length int) []byte {
+	if enc == nil {
+		n := length
+		for n > 0 && !utf8.RuneStart(b[n]) {
+			n--
+		}
+		return b[:n]
+	}
+
+	// GBK、GB18030 的编码没有状态，逐个字符编码的结果和整体编码相同
+	encoder := enc.NewEncoder()
+	out := make([]byte, 0, length)
+	for _, r := range str {
+		rb, err := encoder.Bytes([]byte(string(r)))
+		if err != nil || len(out)+len(rb) > length {
+			break
+		}
+		out = append(out, rb...)
+	}
+	return out
+}
+
+// trimPad 去掉解码时读取的填充字节
+func trimPad(b []byte, to tagOptions) []byte {
+	if !to.pad {
+		return b
+	}
+	if to.padLeft {
+		return bytes.TrimLeft(b, string(to.padByte))
+	}
+	return bytes.TrimRight(b, string(to.padByte))
+}
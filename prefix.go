@@ -0,0 +1,112 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// prefix 标签中长度的单位
+const (
+	prefixDefault = iota // string 为字节数，slice 为元素个数，和 lengthref 相同
+	prefixBytes
+	prefixCount
+)
+
+// lengthPrefix 是 prefix 标签指定的长度前缀，string、slice 在自己的数据前面写入长度
+type lengthPrefix struct {
+	typ    reflect.Type
+	varint int
+	unit   int
+}
+
+var prefixTypes = map[string]lengthPrefix{
+	"uint8":      {typ: reflect.TypeOf(uint8(0))},
+	"uint16":     {typ: reflect.TypeOf(uint16(0))},
+	"uint32":     {typ: reflect.TypeOf(uint32(0))},
+	"uint64":     {typ: reflect.TypeOf(uint64(0))},
+	"varint":     {typ: reflect.TypeOf(int64(0)), varint: varintSigned},
+	"uvarint":    {typ: reflect.TypeOf(uint64(0)), varint: varintUnsigned},
+	"mqttvarint": {typ: reflect.TypeOf(uint64(0)), varint: varintMQTT},
+}
+
+// parsePrefix 解析 prefix 标签，例如 prefix:uint16 prefix:uvarint,bytes
+// 出错时同样返回非 nil 的 lengthPrefix，编解码时返回 TagErr
+func parsePrefix(s string) (*lengthPrefix, error) {
+	params := strings.Split(s, ",")
+	p, ok := prefixTypes[params[0]]
+	if !ok {
+		return &p, fmt.Errorf("prefix type %q is invalid", params[0])
+	}
+	for _, param := range params[1:] {
+		switch param {
+		case "bytes":
+			p.unit = prefixBytes
+		case "count":
+			p.unit = prefixCount
+		default:
+			return &p, fmt.Errorf("prefix option %q is invalid", param)
+		}
+	}
+	return &p, nil
+}
+
+// prefixOptions 返回编解码长度前缀使用的标签，字节序和字段相同
+func prefixOptions(to tagOptions) tagOptions {
+	return tagOptions{length: -1, byteOrder: to.byteOrder, varint: to.prefix.varint, wrap: to.wrap}
+}
+
+func checkPrefix(c *CodecState, to tagOptions) {
+	if to.prefixErr != nil {
+		c.error(&TagErr{to.prefixErr})
+	}
+}
+
+// writePrefix 写入长度前缀
+func writePrefix(c *CodecState, to tagOptions, n int) {
+	checkPrefix(c, to)
+	v := reflect.New(to.prefix.typ).Elem()
+	if v.Kind() == reflect.Int64 {
+		v.SetInt(int64(n))
+	} else {
+		if !to.wrap && v.OverflowUint(uint64(n)) {
+			c.error(&OverflowError{Field: c.fieldName(), Width: v.Type().Bits(), Value: int64(n)})
+		}
+		v.SetUint(uint64(n))
+	}
+	typeCodec(v.Type()).encode(c, v, prefixOptions(to))
+}
+
+// readPrefix 读取长度前缀，bytes 表示长度是否为字节数
+func readPrefix(c *CodecState, to tagOptions, bytes bool) int {
+	checkPrefix(c, to)
+	v := reflect.New(to.prefix.typ).Elem()
+	typeCodec(v.Type()).decode(c, v, prefixOptions(to))
+
+	var n uint64
+	if v.Kind() == reflect.Int64 {
+		if v.Int() < 0 {
+			c.error(&LengthErr{fmt.Errorf("negative prefix length %d", v.Int())})
+		}
+		n = uint64(v.Int())
+	} else {
+		n = v.Uint()
+	}
+	if n > uint64(maxInt) {
+		c.error(&LengthErr{fmt.Errorf("prefix length %d is too large", n)})
+	}
+	// 不是流式解码时，前缀表示的字节数不会超过剩余的数据，提前返回错误，避免分配过大的空间
+	if bytes && c.r == nil && int(n) > c.Len() {
+		c.error(ErrShortData)
+	}
+	return int(n)
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// withoutPrefix 返回 slice 元素使用的标签，长度前缀只属于 slice 本身
+func (to tagOptions) withoutPrefix() tagOptions {
+	to.prefix = nil
+	to.prefixErr = nil
+	return to
+}
@@ -0,0 +1,128 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// An UnknownIDError is returned by Router.Dispatch when no handler is
+// registered for the message ID in the header.
+type UnknownIDError struct {
+	ID     interface{}
+	Header interface{} // 已经解码的消息头
+}
+
+func (e *UnknownIDError) Error() string {
+	return fmt.Sprintf("bytecodec: no handler registered for message id %v", e.ID)
+}
+
+// A RouteError describes a failure while dispatching a frame.
+type RouteError struct {
+	ID   interface{} // 解码消息头失败时为 nil
+	Op   string      // "header"、"body" 或 "handler"
+	Type reflect.Type
+	Err  error
+}
+
+func (e *RouteError) Error() string {
+	if e.ID == nil {
+		return "bytecodec: router decode " + e.Op + " " + e.Type.String() + ": " + e.Err.Error()
+	}
+	return fmt.Sprintf("bytecodec: router message id %v %s %s: %s", e.ID, e.Op, e.Type, e.Err)
+}
+
+func (e *RouteError) Unwrap() error { return e.Err }
+
+type route struct {
+	body    reflect.Type
+	handler reflect.Value
+}
+
+// Router 先解码消息头，再根据消息头中的 ID 字段选择消息体的类型解码，然后调用对应的处理函数
+type Router struct {
+	header  reflect.Type
+	idIndex int
+
+	mu     sync.RWMutex
+	routes map[interface{}]route
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// NewRouter 创建一个 Router，header 是消息头结构体的值或者指针，idField 是消息头中 ID 字段的名字，
+// ID 字段可以是整数或者 string 类型。参数不正确时会 panic
+func NewRouter(header interface{}, idField string) *Router {
+	t := reflect.TypeOf(header)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("bytecodec: NewRouter header must be a struct, got %v", t))
+	}
+	sf, ok := t.FieldByName(idField)
+	if !ok || len(sf.Index) != 1 {
+		panic(fmt.Sprintf("bytecodec: NewRouter header %s has no field %s", t, idField))
+	}
+	if _, ok := unionKey(reflect.New(sf.Type).Elem()); !ok {
+		panic(fmt.Sprintf("bytecodec: NewRouter id field %s type %s is invalid", idField, sf.Type))
+	}
+	typeCodec(t)
+	return &Router{header: t, idIndex: sf.Index[0], routes: map[interface{}]route{}}
+}
+
+// Handle 注册消息 ID 对应的处理函数，处理函数的形式为 func(*Header, *Body) error，
+// 消息体的类型从处理函数的第二个参数得到，两个参数都会是新解码出来的值。
+// 同一个 ID 多次注册时会覆盖之前的注册。参数不正确时会 panic
+func (r *Router) Handle(id interface{}, handler interface{}) {
+	key, ok := unionKey(reflect.ValueOf(id))
+	if !ok {
+		panic(fmt.Sprintf("bytecodec: Router.Handle invalid id %#v", id))
+	}
+
+	hv := reflect.ValueOf(handler)
+	ht := hv.Type()
+	if ht.Kind() != reflect.Func || ht.NumIn() != 2 || ht.NumOut() != 1 ||
+		ht.In(0) != reflect.PtrTo(r.header) || ht.In(1).Kind() != reflect.Ptr || ht.Out(0) != errorType {
+		panic(fmt.Sprintf("bytecodec: Router.Handle handler must be func(*%s, *Body) error, got %s", r.header, ht))
+	}
+	body := ht.In(1).Elem()
+	typeCodec(body)
+
+	r.mu.Lock()
+	r.routes[key] = route{body: body, handler: hv}
+	r.mu.Unlock()
+}
+
+// Dispatch 解码 frame 中的消息头和消息体，并调用消息 ID 对应的处理函数，返回处理函数的错误。
+// 消息头之后的全部字节都作为消息体解码
+func (r *Router) Dispatch(frame []byte) error {
+	d := newCodecState()
+	d.Write(frame)
+
+	header := reflect.New(r.header)
+	if err := d.unmarshal(header); err != nil {
+		return &RouteError{Op: "header", Type: r.header, Err: err}
+	}
+	id := header.Elem().Field(r.idIndex)
+	key, _ := unionKey(id)
+
+	r.mu.RLock()
+	rt, ok := r.routes[key]
+	r.mu.RUnlock()
+	if !ok {
+		return &UnknownIDError{ID: id.Interface(), Header: header.Interface()}
+	}
+
+	body := reflect.New(rt.body)
+	if err := d.unmarshal(body); err != nil {
+		return &RouteError{ID: id.Interface(), Op: "body", Type: rt.body, Err: err}
+	}
+	encodeStatePool.Put(d)
+
+	out := rt.handler.Call([]reflect.Value{header, body})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return &RouteError{ID: id.Interface(), Op: "handler", Type: rt.body, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package bytecodec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type routerHeader struct {
+	MsgID    uint16
+	SerialNo uint16
+}
+
+type routerLocation struct {
+	Lat int32
+	Lng int32
+}
+
+type routerText struct {
+	Text string
+}
+
+func TestRouter(t *testing.T) {
+	var gotHeader *routerHeader
+	var gotLocation *routerLocation
+	var gotText *routerText
+	errHandler := errors.New("handler error")
+
+	r := NewRouter(routerHeader{}, "MsgID")
+	r.Handle(0x0200, func(h *routerHeader, body *routerLocation) error {
+		gotHeader, gotLocation = h, body
+		return nil
+	})
+	r.Handle(0x0300, func(h *routerHeader, body *routerText) error {
+		gotHeader, gotText = h, body
+		return errHandler
+	})
+
+	err := r.Dispatch([]byte{0x2, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x2})
+	if err != nil {
+		t.Fatalf("Dispatch unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(gotHeader, &routerHeader{MsgID: 0x0200, SerialNo: 1}) ||
+		!reflect.DeepEqual(gotLocation, &routerLocation{Lat: 1, Lng: 2}) {
+		t.Errorf("Dispatch location = %#v %#v", gotHeader, gotLocation)
+	}
+
+	err = r.Dispatch([]byte{0x3, 0x0, 0x0, 0x2, 0x68, 0x69})
+	if !errors.Is(err, errHandler) {
+		t.Errorf("Dispatch text error = %v, want %v", err, errHandler)
+	}
+	if !reflect.DeepEqual(gotText, &routerText{Text: "hi"}) {
+		t.Errorf("Dispatch text = %#v", gotText)
+	}
+
+	var uie *UnknownIDError
+	err = r.Dispatch([]byte{0x4, 0x0, 0x0, 0x3})
+	if !errors.As(err, &uie) || uie.ID != uint16(0x0400) {
+		t.Errorf("Dispatch unknown id error = %v, want UnknownIDError", err)
+	}
+
+	var re *RouteError
+	err = r.Dispatch([]byte{0x2, 0x0, 0x0, 0x1, 0x0})
+	if !errors.As(err, &re) || re.Op != "body" {
+		t.Errorf("Dispatch short body error = %v, want RouteError", err)
+	}
+	err = r.Dispatch([]byte{0x2})
+	if !errors.As(err, &re) || re.Op != "header" {
+		t.Errorf("Dispatch short header error = %v, want RouteError", err)
+	}
+}
+
+func TestRouterHandlePanics(t *testing.T) {
+	r := NewRouter(&routerHeader{}, "MsgID")
+	handlers := []interface{}{
+		func(h routerHeader, body *routerText) error { return nil },
+		func(h *routerHeader, body routerText) error { return nil },
+		func(h *routerHeader, body *routerText) {},
+		"handler",
+	}
+	for _, h := range handlers {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle %T, expected panic", h)
+				}
+			}()
+			r.Handle(1, h)
+		}()
+	}
+}
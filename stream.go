@@ -0,0 +1,112 @@
+package bytecodec
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+)
+
+// An Encoder writes values to an output stream.
+type Encoder struct {
+	w    io.Writer
+	opts MarshalOptions
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// SetByteOrder 设置数值类型字段的默认字节序，参考 MarshalOptions.ByteOrder
+func (enc *Encoder) SetByteOrder(order binary.ByteOrder) {
+	enc.opts.ByteOrder = order
+}
+
+// Encode 编码 v 并写入到流中
+func (enc *Encoder) Encode(v interface{}) error {
+	b, err := enc.opts.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(b)
+	return err
+}
+
+// A Decoder reads and decodes values from an input stream.
+//
+// Decoder 按照结构的定义只读取需要的字节数，不会预读后续数据，
+// 所以同一个 io.Reader 可以连续解码多个值；在 TCP 连接上使用时，可以用 bufio.Reader 包装减少系统调用。
+// 需要读取全部剩余字节的字段（例如没有指定长度的 string、slice、map）只能在 lengthref 限定的范围内读取，
+// 没有限定范围时无法确定字段的结束位置，返回 ErrUnbounded。
+type Decoder struct {
+	cs   *CodecState
+	opts UnmarshalOptions
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	cs := newCodecState()
+	cs.r = r
+	return &Decoder{cs: cs}
+}
+
+// SetByteOrder 设置数值类型字段的默认字节序，参考 UnmarshalOptions.ByteOrder
+func (dec *Decoder) SetByteOrder(order binary.ByteOrder) {
+	dec.opts.ByteOrder = order
+}
+
+// DisallowTrailingBytes 使 Decoder 在值解码完成后检查流中是否还有数据，有则返回 *TrailingDataError
+// 检查时会一直读取到 io.EOF，所以只适用于只包含一个值的流，例如文件或者 HTTP 请求体
+func (dec *Decoder) DisallowTrailingBytes() {
+	dec.opts.DisallowTrailingBytes = true
+}
+
+// Decode 从流中读取下一个值并解码到 v 中，流中没有更多数据时返回 io.EOF
+func (dec *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &InvalidUnmarshalError{reflect.TypeOf(v)}
+	}
+
+	pt := newPointerTrack()
+	dec.cs.pt = &pt
+	dec.cs.order = dec.opts.ByteOrder
+	dec.cs.off = 0
+
+	more, err := dec.more()
+	if err != nil {
+		return err
+	}
+	if !more {
+		return io.EOF
+	}
+	if err := dec.cs.unmarshal(rv); err != nil {
+		return err
+	}
+	if dec.opts.DisallowTrailingBytes {
+		return dec.checkTrailing()
+	}
+	return nil
+}
+
+func (dec *Decoder) checkTrailing() error {
+	offset := dec.cs.off
+	var rest []byte
+	err := dec.cs.code(func(c *CodecState, _ reflect.Value, _ tagOptions) {
+		rest = c.readRemaining()
+	}, reflect.Value{})
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return &TrailingDataError{Offset: offset, Count: len(rest)}
+	}
+	return nil
+}
+
+func (dec *Decoder) more() (more bool, err error) {
+	err = dec.cs.code(func(c *CodecState, _ reflect.Value, _ tagOptions) {
+		more = c.more()
+	}, reflect.Value{})
+	return
+}
@@ -0,0 +1,113 @@
+package bytecodec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+type streamBody struct {
+	Code uint8
+	Msg  string
+}
+
+type streamPacket struct {
+	SerialNo   uint16
+	BodyLength uint8 `bytecodec:"lengthref:Body"`
+	Body       streamBody
+	Array      [2]byte
+}
+
+var streamPackets = []*streamPacket{
+	{SerialNo: 1, BodyLength: 3, Body: streamBody{Code: 1, Msg: "ok"}, Array: [2]byte{1, 2}},
+	{SerialNo: 2, BodyLength: 6, Body: streamBody{Code: 2, Msg: "error"}, Array: [2]byte{3, 4}},
+	{SerialNo: 3, BodyLength: 1, Body: streamBody{Code: 3}, Array: [2]byte{5, 6}},
+}
+
+var streamBytes = []byte{
+	0x0, 0x1, 0x3, 0x1, 0x6f, 0x6b, 0x1, 0x2,
+	0x0, 0x2, 0x6, 0x2, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x3, 0x4,
+	0x0, 0x3, 0x1, 0x3, 0x5, 0x6,
+}
+
+func TestEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, p := range streamPackets {
+		if err := enc.Encode(p); err != nil {
+			t.Fatalf("Encode %#v, unexpected error: %s", p, err)
+		}
+	}
+	if !reflect.DeepEqual(buf.Bytes(), streamBytes) {
+		t.Errorf("Encode = %#v, want %#v", buf.Bytes(), streamBytes)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(streamBytes)))
+	for _, want := range streamPackets {
+		out := &streamPacket{}
+		if err := dec.Decode(out); err != nil {
+			t.Fatalf("Decode unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("Decode = %#v, want %#v", out, want)
+		}
+	}
+	if err := dec.Decode(&streamPacket{}); err != io.EOF {
+		t.Errorf("Decode at end of stream = %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderShortData(t *testing.T) {
+	dec := NewDecoder(bytes.NewReader(streamBytes[:5]))
+	if err := dec.Decode(&streamPacket{}); err == nil {
+		t.Errorf("Decode short data, expected error")
+	}
+}
+
+func TestDecoderReadsExactly(t *testing.T) {
+	r := bytes.NewReader(streamBytes)
+	dec := NewDecoder(r)
+	if err := dec.Decode(&streamPacket{}); err != nil {
+		t.Fatalf("Decode unexpected error: %s", err)
+	}
+	if r.Len() != len(streamBytes)-8 {
+		t.Errorf("Decode consumed %d bytes, want 8", len(streamBytes)-r.Len())
+	}
+}
+
+func TestDecoderUnbounded(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			Code uint8
+			Msg  string
+		}{},
+		&struct{ Items []uint16 }{},
+		&struct{ Attrs map[uint8]uint8 }{},
+	} {
+		var fe *FieldError
+		err := NewDecoder(bytes.NewReader([]byte{0x1, 0x2, 0x3, 0x4})).Decode(v)
+		if !errors.Is(err, ErrUnbounded) || !errors.As(err, &fe) {
+			t.Errorf("Decode %T got error %v, want FieldError wrapping ErrUnbounded", v, err)
+		}
+	}
+}
+
+func TestDecoderDisallowTrailingBytes(t *testing.T) {
+	dec := NewDecoder(iotest.OneByteReader(bytes.NewReader(streamBytes)))
+	dec.DisallowTrailingBytes()
+	err := dec.Decode(&streamPacket{})
+	if te, ok := err.(*TrailingDataError); !ok || te.Offset != 8 || te.Count != len(streamBytes)-8 {
+		t.Errorf("Decode trailing bytes error = %v, want offset 8 count %d", err, len(streamBytes)-8)
+	}
+
+	dec = NewDecoder(bytes.NewReader(streamBytes[:8]))
+	dec.DisallowTrailingBytes()
+	if err := dec.Decode(&streamPacket{}); err != nil {
+		t.Errorf("Decode unexpected error: %s", err)
+	}
+}
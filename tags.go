@@ -1,24 +1,74 @@
 package bytecodec
 
 import (
+	"encoding/binary"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 type tagOptions struct {
-	lengthref       string
-	length          int // 小于 0 会读取全部剩余字节，默认为 -1
+	lengthref       string // lengthref、sizeref、countref 指向的字段
+	refUnit         int    // lengthref 指向的字段的长度单位
+	refScale        int    // lengthref 字段的值 = (长度 + refAdjust) / refScale
+	refAdjust       int
+	refSpanEnd      string      // lengthref:A..D 中最后一个字段，长度为 A 到 D 编码后的字节数
+	refPath         *refPath    // lengthref:^.Body、lengthref:Body.Payload 指向其他结构体中的字段
+	lengthExpr      *lengthExpr // length 标签中引用其他字段的长度表达式
+	lengthErr       error       // 解析 lengthref、length 标签时的错误，编解码时返回 TagErr
+	length          int         // 小于 0 会读取全部剩余字节，默认为 -1
 	gbk             bool
 	gbk18030        bool
 	bcd8421         int
-	bcd8421Skipzero bool // 解码时是否跳过数字前面的 0
+	bcd8421Skipzero bool             // 解码时是否跳过数字前面的 0
+	byteOrder       binary.ByteOrder // 为 nil 时使用外层结构或调用参数指定的字节序
+	checksum        string           // 校验算法，字段的值在编码时自动计算，解码时校验
+	checksumFrom    string           // 校验范围的第一个字段，默认为结构体的第一个字段
+	checksumTo      string           // 校验范围的最后一个字段，默认为校验字段的前一个字段
+	bits            int              // 大于 0 时，连续的 bits 字段共享同一个比特流
+	bitsLSB         bool             // 比特流先使用字节的低位，默认先使用高位
+	bitsErr         error            // 解析 bits 标签时的错误，编解码时返回 TagErr
+	varint          int              // 整数的变长编码方式，为 varintNone 时使用固定长度
+	varintErr       error            // 同时使用了多个变长编码标签时的错误，编解码时返回 TagErr
+	wrap            bool             // 值超出字段的范围时只保留低位，不返回 OverflowError
+	cond            *condition       // if 标签的条件，不成立时跳过这个字段
+	condErr         error            // 解析 if 标签时的错误，编解码时返回 TagErr
+	union           string           // 接口类型字段的判别字段，具体类型通过 RegisterUnion 注册
+	mapKey          *tagOptions      // map 的键使用的标签，通过 key. 前缀指定
+	mapValue        *tagOptions      // map 的值使用的标签，通过 value. 前缀指定
+	pad             bool             // 定长字符串不足长度时填充，解码时去掉填充
+	padByte         byte             // 填充使用的字节，默认为空格
+	padLeft         bool             // 在字符串前面填充，默认在后面填充
+	padErr          error            // 解析 pad 标签时的错误，编解码时返回 TagErr
+	truncate        bool             // 定长字符串超过长度时截断，不返回 LengthErr
+	cstring         bool             // 以 0x00 结束的字符串
+	cstringMax      int              // cstring 包括结束符在内的最大字节数，为 0 时不限制
+	cstringErr      error            // 解析 cstring 标签时的错误，编解码时返回 TagErr
+	prefix          *lengthPrefix    // string、slice 在数据前面写入的长度前缀
+	prefixErr       error            // 解析 prefix 标签时的错误，编解码时返回 TagErr
 }
 
+// lengthref 指向的字段的长度单位
+const (
+	refDefault = iota // lengthref，string 为字节数，slice、array、map 为元素个数，其他类型为字节数
+	refSize           // sizeref，编码后的字节数
+	refCount          // countref，slice、array、map 的元素个数
+)
+
 func parseTag(tag string) tagOptions {
 	settings := map[string]string{}
+	var keyTags, valueTags []string
 	names := strings.Split(tag, ";")
 	for _, i := range names {
-		s := strings.Split(i, ":")
+		if strings.HasPrefix(i, "key.") {
+			keyTags = append(keyTags, strings.TrimPrefix(i, "key."))
+			continue
+		}
+		if strings.HasPrefix(i, "value.") {
+			valueTags = append(valueTags, strings.TrimPrefix(i, "value."))
+			continue
+		}
+		s := strings.SplitN(i, ":", 2)
 		if len(s) < 2 {
 			settings[s[0]] = ""
 			continue
@@ -27,12 +77,38 @@ func parseTag(tag string) tagOptions {
 	}
 	to := tagOptions{}
 
-	to.lengthref = settings["lengthref"]
+	var refs []string
+	for _, r := range []struct {
+		name string
+		unit int
+	}{
+		{"lengthref", refDefault},
+		{"sizeref", refSize},
+		{"countref", refCount},
+	} {
+		if ref, ok := settings[r.name]; ok {
+			if err := parseLengthref(&to, ref, settings); err != nil && to.lengthErr == nil {
+				to.lengthErr = err
+			}
+			to.refUnit = r.unit
+			refs = append(refs, r.name)
+		}
+	}
 	to.length = -1
-	length := settings["length"]
-	l, err := strconv.Atoi(length)
-	if err == nil {
-		to.length = l
+	if length, ok := settings["length"]; ok {
+		if l, err := strconv.Atoi(length); err == nil {
+			to.length = l
+		} else if expr, err := parseLengthExpr(length); err != nil {
+			if to.lengthErr == nil {
+				to.lengthErr = err
+			}
+		} else {
+			to.lengthExpr = expr
+		}
+	}
+	// 保留第一个错误
+	if len(refs) > 1 && to.lengthErr == nil {
+		to.lengthErr = fmt.Errorf("conflicting length tags %s", strings.Join(refs, ", "))
 	}
 
 	if _, ok := settings["gbk"]; ok {
@@ -42,6 +118,113 @@ func parseTag(tag string) tagOptions {
 		to.gbk18030 = true
 	}
 
+	if _, ok := settings["le"]; ok {
+		to.byteOrder = binary.LittleEndian
+	}
+	if _, ok := settings["be"]; ok {
+		to.byteOrder = binary.BigEndian
+	}
+
+	to.checksum = settings["checksum"]
+	to.checksumFrom = settings["from"]
+	to.checksumTo = settings["to"]
+
+	var varints []string
+	for _, v := range []struct {
+		name   string
+		varint int
+	}{
+		{"varint", varintSigned},
+		{"uvarint", varintUnsigned},
+		{"zigzag", varintZigzag},
+		{"mqttvarint", varintMQTT},
+	} {
+		if _, ok := settings[v.name]; ok {
+			to.varint = v.varint
+			varints = append(varints, v.name)
+		}
+	}
+	if len(varints) > 1 {
+		to.varintErr = fmt.Errorf("conflicting varint tags %s", strings.Join(varints, ", "))
+	}
+
+	to.union = settings["switch"]
+
+	if _, ok := settings["wrap"]; ok {
+		to.wrap = true
+	}
+
+	if len(keyTags) > 0 {
+		keyOptions := parseTag(strings.Join(keyTags, ";"))
+		to.mapKey = &keyOptions
+	}
+	if len(valueTags) > 0 {
+		valueOptions := parseTag(strings.Join(valueTags, ";"))
+		to.mapValue = &valueOptions
+	}
+
+	if expr, ok := settings["if"]; ok {
+		to.cond, to.condErr = parseCondition(expr)
+	}
+
+	if bits, ok := settings["bits"]; ok {
+		params := strings.Split(bits, ",")
+		n, err := strconv.Atoi(params[0])
+		if err != nil || n <= 0 || n > 64 {
+			to.bitsErr = fmt.Errorf("bits %q is invalid", bits)
+		} else {
+			to.bits = n
+		}
+		if len(params) > 1 {
+			if len(params) > 2 || params[1] != "lsb" {
+				to.bitsErr = fmt.Errorf("bits %q is invalid", bits)
+			}
+			to.bitsLSB = true
+		}
+	}
+
+	if pad, ok := settings["pad"]; ok {
+		to.pad = true
+		to.padByte = ' '
+		params := strings.Split(pad, ",")
+		switch params[0] {
+		case "", "space":
+		case "nul":
+			to.padByte = 0
+		default:
+			to.padErr = fmt.Errorf("pad %q is invalid", pad)
+		}
+		if len(params) > 1 {
+			switch params[1] {
+			case "left":
+				to.padLeft = true
+			case "right":
+			default:
+				to.padErr = fmt.Errorf("pad %q is invalid", pad)
+			}
+		}
+		if len(params) > 2 {
+			to.padErr = fmt.Errorf("pad %q is invalid", pad)
+		}
+	}
+	if max, ok := settings["cstring"]; ok {
+		to.cstring = true
+		if max != "" {
+			// 最大字节数包括结束符，至少为 1
+			if n, err := strconv.Atoi(max); err == nil && n > 0 {
+				to.cstringMax = n
+			} else {
+				to.cstringErr = fmt.Errorf("cstring max length %q is invalid", max)
+			}
+		}
+	}
+	if prefix, ok := settings["prefix"]; ok {
+		to.prefix, to.prefixErr = parsePrefix(prefix)
+	}
+	if _, ok := settings["truncate"]; ok {
+		to.truncate = true
+	}
+
 	if bcd, ok := settings["bcd8421"]; ok {
 		params := strings.Split(bcd, ",")
 		bcdlength, err := strconv.Atoi(params[0])
@@ -0,0 +1,176 @@
+package bytecodec
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// An UnknownVariantError is returned when a union field has no registered
+// concrete type for its discriminator value, or when the concrete type of
+// the value being encoded is not registered.
+type UnknownVariantError struct {
+	Interface     reflect.Type
+	Discriminator interface{}  // 解码时没有注册的判别值
+	Type          reflect.Type // 编码时没有注册的具体类型
+}
+
+func (e *UnknownVariantError) Error() string {
+	if e.Type != nil {
+		return fmt.Sprintf("bytecodec: type %s is not registered for union %s", e.Type, e.Interface)
+	}
+	return fmt.Sprintf("bytecodec: no type registered for union %s discriminator %v", e.Interface, e.Discriminator)
+}
+
+type union struct {
+	byKey  map[interface{}]reflect.Type
+	byType map[reflect.Type]interface{}
+}
+
+var (
+	unionMu       sync.RWMutex
+	unionRegistry = map[reflect.Type]*union{}
+)
+
+// RegisterUnion 为接口类型 iface 注册判别值到具体类型的映射，配合 switch 标签使用，
+// 解码时根据之前解码的判别字段的值创建对应的具体类型，编码时根据具体类型自动写入判别字段。
+// 判别值可以是任意整数类型或者 string，整数会按照数值比较，和判别字段的具体类型无关。
+// 同一个接口类型可以用于不同类型的判别字段，所以注册时不检查判别值的范围，
+// 编码时判别值超出判别字段的范围会返回 OverflowError。
+// 具体类型可以是指针或者非指针类型，解码时会按照注册的类型设置到接口字段中。
+//
+// RegisterUnion 应该在 init 中调用，同一个接口类型多次注册时会覆盖之前的注册。
+// 参数不正确时会 panic。
+func RegisterUnion(iface reflect.Type, variants map[interface{}]reflect.Type) {
+	if iface == nil || iface.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("bytecodec: RegisterUnion of non-interface type %v", iface))
+	}
+	u := &union{
+		byKey:  make(map[interface{}]reflect.Type, len(variants)),
+		byType: make(map[reflect.Type]interface{}, len(variants)),
+	}
+	for k, t := range variants {
+		key, ok := unionKey(reflect.ValueOf(k))
+		if !ok {
+			panic(fmt.Sprintf("bytecodec: RegisterUnion invalid discriminator %#v", k))
+		}
+		if t == nil || !t.Implements(iface) {
+			panic(fmt.Sprintf("bytecodec: RegisterUnion type %v does not implement %s", t, iface))
+		}
+		if _, ok := u.byType[t]; ok {
+			panic(fmt.Sprintf("bytecodec: RegisterUnion duplicate type %s", t))
+		}
+		u.byKey[key] = t
+		u.byType[t] = key
+	}
+	unionMu.Lock()
+	unionRegistry[iface] = u
+	unionMu.Unlock()
+}
+
+func lookupUnion(iface reflect.Type) *union {
+	unionMu.RLock()
+	defer unionMu.RUnlock()
+	return unionRegistry[iface]
+}
+
+// unionKey 把判别值统一为 int64 或者 string
+func unionKey(v reflect.Value) (interface{}, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), true
+	case reflect.String:
+		return v.String(), true
+	}
+	return nil, false
+}
+
+func (sc structCoder) fieldUnion(c *CodecState, f field, t reflect.Type) *union {
+	if t.Kind() != reflect.Interface {
+		c.error(&TagErr{fmt.Errorf("switch %s type %q is invalid", f.name, t.Kind())})
+	}
+	u := lookupUnion(t)
+	if u == nil {
+		c.error(&TagErr{fmt.Errorf("switch %s union %s is not registered", f.name, t)})
+	}
+	return u
+}
+
+// discriminator 如果第 i 个字段是某个 union 字段的判别字段，返回根据 union 字段的具体类型得到的判别值
+// union 字段为 nil 时使用判别字段本身的值
+func (sc structCoder) discriminator(c *CodecState, v reflect.Value, i int) (reflect.Value, bool) {
+	f := sc.fields.list[i]
+	for _, uf := range sc.fields.list[i+1:] {
+		if uf.tagOptions.union != f.name {
+			continue
+		}
+		ufv := v.Field(uf.index)
+		u := sc.fieldUnion(c, uf, ufv.Type())
+		if ufv.IsNil() {
+			return reflect.Value{}, false
+		}
+		key, ok := u.byType[ufv.Elem().Type()]
+		if !ok {
+			c.error(&UnknownVariantError{Interface: ufv.Type(), Type: ufv.Elem().Type()})
+		}
+
+		// 判别值超出判别字段的范围时截断写入的值解码时找不到对应的类型
+		dv := reflect.New(v.Field(f.index).Type()).Elem()
+		switch k := key.(type) {
+		case int64:
+			switch dv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				if dv.OverflowInt(k) {
+					c.error(&OverflowError{Field: f.name, Width: dv.Type().Bits(), Value: k})
+				}
+				dv.SetInt(k)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				// 64 位的无符号判别值注册时按照 int64 保存，超过 MaxInt64 的值是负数
+				if k < 0 && dv.Type().Bits() < 64 || dv.OverflowUint(uint64(k)) {
+					c.error(&OverflowError{Field: f.name, Width: dv.Type().Bits(), Value: k})
+				}
+				dv.SetUint(uint64(k))
+			default:
+				c.error(&TagErr{fmt.Errorf("switch %s field %s type %q is invalid", uf.name, f.name, dv.Kind())})
+			}
+		case string:
+			if dv.Kind() != reflect.String {
+				c.error(&TagErr{fmt.Errorf("switch %s field %s type %q is invalid", uf.name, f.name, dv.Kind())})
+			}
+			dv.SetString(k)
+		}
+		return dv, true
+	}
+	return reflect.Value{}, false
+}
+
+// newVariant 根据已经解码的判别字段的值，为第 i 个字段创建具体类型的值，
+// 返回指向这个值的指针，isPtr 表示注册的具体类型是否是指针类型
+func (sc structCoder) newVariant(c *CodecState, v reflect.Value, i int) (variant reflect.Value, isPtr bool) {
+	f := sc.fields.list[i]
+	fv := v.Field(f.index)
+	u := sc.fieldUnion(c, f, fv.Type())
+
+	for _, df := range sc.fields.list[:i] {
+		if df.name != f.tagOptions.union {
+			continue
+		}
+		dv := v.Field(df.index)
+		key, ok := unionKey(dv)
+		if !ok {
+			c.error(&TagErr{fmt.Errorf("switch %s field %s type %q is invalid", f.name, df.name, dv.Kind())})
+		}
+		t, ok := u.byKey[key]
+		if !ok {
+			c.error(&UnknownVariantError{Interface: fv.Type(), Discriminator: dv.Interface()})
+		}
+		if t.Kind() == reflect.Ptr {
+			return reflect.New(t.Elem()), true
+		}
+		return reflect.New(t), false
+	}
+	c.error(&TagErr{fmt.Errorf("switch %s not fount field %s before it", f.name, f.tagOptions.union)})
+	return
+}
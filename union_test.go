@@ -0,0 +1,105 @@
+package bytecodec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type unionBody interface {
+	isUnionBody()
+}
+
+type unionLocation struct {
+	Lat int32
+	Lng int32
+}
+
+func (unionLocation) isUnionBody() {}
+
+type unionText struct {
+	Text string
+}
+
+func (*unionText) isUnionBody() {}
+
+type unionPacket struct {
+	MsgID      uint16
+	BodyLength uint8     `bytecodec:"lengthref:Body"`
+	Body       unionBody `bytecodec:"switch:MsgID"`
+	Tail       uint8
+}
+
+func init() {
+	RegisterUnion(reflect.TypeOf((*unionBody)(nil)).Elem(), map[interface{}]reflect.Type{
+		0x0200: reflect.TypeOf(unionLocation{}),
+		0x0300: reflect.TypeOf(&unionText{}),
+	})
+}
+
+var unionTests = []testcase{{
+	[]byte{
+		0x2, 0x0,
+		0x8,
+		0x0, 0x0, 0x0, 0x1, 0xff, 0xff, 0xff, 0xfe,
+		0x9,
+	},
+	&unionPacket{},
+	&unionPacket{MsgID: 0x0200, BodyLength: 8, Body: unionLocation{Lat: 1, Lng: -2}, Tail: 9},
+}, {
+	[]byte{
+		0x3, 0x0,
+		0x2,
+		0x68, 0x69,
+		0x9,
+	},
+	&unionPacket{},
+	&unionPacket{MsgID: 0x0300, BodyLength: 2, Body: &unionText{Text: "hi"}, Tail: 9},
+}}
+
+func TestUnion(t *testing.T) {
+	testMarshalUnmarshal(t, unionTests)
+}
+
+func TestUnionDiscriminator(t *testing.T) {
+	v := &unionPacket{Body: &unionText{Text: "hi"}}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal %#v, unexpected error: %s", v, err)
+	}
+	want := []byte{0x3, 0x0, 0x2, 0x68, 0x69, 0x0}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("Marshal %#v = %#v, want %#v", v, b, want)
+	}
+}
+
+type unknownUnionBody struct{}
+
+func (unknownUnionBody) isUnionBody() {}
+
+func TestUnknownVariant(t *testing.T) {
+	var uve *UnknownVariantError
+	_, err := Marshal(&unionPacket{Body: unknownUnionBody{}})
+	if !errors.As(err, &uve) || uve.Type != reflect.TypeOf(unknownUnionBody{}) {
+		t.Errorf("Marshal unknown variant error = %v, want UnknownVariantError", err)
+	}
+
+	err = Unmarshal([]byte{0x4, 0x0, 0x0, 0x0}, &unionPacket{})
+	if !errors.As(err, &uve) || uve.Discriminator != uint16(0x0400) {
+		t.Errorf("Unmarshal unknown variant error = %v, want UnknownVariantError", err)
+	}
+}
+
+type narrowUnionPacket struct {
+	MsgID uint8
+	Body  unionBody `bytecodec:"switch:MsgID"`
+}
+
+func TestUnionDiscriminatorOverflow(t *testing.T) {
+	// 0x0200 超出 uint8 判别字段的范围，截断后写入的 0x00 无法解码
+	var oe *OverflowError
+	_, err := Marshal(&narrowUnionPacket{Body: unionLocation{Lat: 1}})
+	if !errors.As(err, &oe) || *oe != (OverflowError{"MsgID", 8, int64(0x0200)}) {
+		t.Errorf("Marshal narrow discriminator got error %v, want OverflowError", err)
+	}
+}
@@ -0,0 +1,162 @@
+package bytecodec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// 整数类型字段的变长编码方式
+const (
+	varintNone   = iota
+	varintSigned // 有符号 LEB128，使用补码表示负数
+	varintUnsigned
+	varintZigzag // ZigZag 编码后使用无符号 LEB128，和 protobuf 的 sint 类型相同
+	varintMQTT   // MQTT 的剩余长度，最多 4 个字节，最大值为 268435455
+)
+
+const (
+	maxMQTTVarint  = 268435455
+	mqttVarintBits = 28 // 每个字节 7 位，最多 4 个字节
+)
+
+type VarintErr struct{ error }
+
+func (e *VarintErr) Error() string {
+	return "bytecodec VarintErr: " + e.error.Error()
+}
+
+func isSignedKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// encodeVarint 按照 to 指定的变长编码写入整数，to 没有指定变长编码时返回 false
+func encodeVarint(c *CodecState, v reflect.Value, to tagOptions) bool {
+	if to.varintErr != nil {
+		c.error(&TagErr{to.varintErr})
+	}
+	if to.varint == varintNone {
+		return false
+	}
+
+	var n int64
+	var u uint64
+	signed := isSignedKind(v.Kind())
+	if signed {
+		n = v.Int()
+		u = uint64(n)
+	} else {
+		u = v.Uint()
+		n = int64(u)
+	}
+
+	switch to.varint {
+	case varintSigned, varintZigzag:
+		if !signed && u > math.MaxInt64 && !to.wrap {
+			c.error(&OverflowError{Field: c.fieldName(), Width: 64, Value: u})
+		}
+		if to.varint == varintZigzag {
+			writeUvarint(c, uint64(n<<1)^uint64(n>>63))
+			return true
+		}
+		for {
+			b := byte(n & 0x7f)
+			n >>= 7
+			if (n == 0 && b&0x40 == 0) || (n == -1 && b&0x40 != 0) {
+				c.WriteByte(b)
+				return true
+			}
+			c.WriteByte(b | 0x80)
+		}
+	default:
+		if signed && n < 0 {
+			c.error(&VarintErr{fmt.Errorf("negative value %d for unsigned varint", n)})
+		}
+		if to.varint == varintMQTT && u > maxMQTTVarint {
+			if !to.wrap {
+				c.error(&OverflowError{Field: c.fieldName(), Width: mqttVarintBits, Value: u})
+			}
+			u &= maxMQTTVarint
+		}
+		writeUvarint(c, u)
+	}
+	return true
+}
+
+func writeUvarint(c *CodecState, u uint64) {
+	for u >= 0x80 {
+		c.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	c.WriteByte(byte(u))
+}
+
+// decodeVarint 按照 to 指定的变长编码读取整数，to 没有指定变长编码时返回 false
+func decodeVarint(c *CodecState, v reflect.Value, to tagOptions) bool {
+	if to.varintErr != nil {
+		c.error(&TagErr{to.varintErr})
+	}
+	if to.varint == varintNone {
+		return false
+	}
+
+	maxBytes := 10
+	if to.varint == varintMQTT {
+		maxBytes = 4
+	}
+
+	var u uint64
+	var shift uint
+	var b byte
+	for i := 0; ; i++ {
+		if i == maxBytes {
+			c.error(&VarintErr{fmt.Errorf("varint longer than %d bytes", maxBytes)})
+		}
+		b = c.ReadByte()
+		// 和 binary.Uvarint 一样，第 10 个字节只有最低位属于 64 位整数，有符号编码的其余位是符号扩展
+		if i == 9 && b > 1 && !(to.varint == varintSigned && b == 0x7f) {
+			c.error(&VarintErr{fmt.Errorf("varint overflows a 64-bit integer")})
+		}
+		u |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	// value 是解码到有符号字段时 OverflowError 中报告的值，有符号的编码报告解码后的有符号值
+	var n int64
+	var value interface{} = u
+	switch to.varint {
+	case varintSigned:
+		n = int64(u)
+		if shift < 64 && b&0x40 != 0 {
+			n |= -1 << shift
+		}
+		u = uint64(n)
+		value = n
+	case varintZigzag:
+		n = int64(u>>1) ^ -int64(u&1)
+		u = uint64(n)
+		value = n
+	default:
+		n = int64(u)
+	}
+
+	if isSignedKind(v.Kind()) {
+		if (((to.varint == varintUnsigned || to.varint == varintMQTT) && n < 0) || v.OverflowInt(n)) && !to.wrap {
+			c.error(&OverflowError{Field: c.fieldName(), Width: v.Type().Bits(), Value: value})
+		}
+		v.SetInt(n)
+		return true
+	}
+	if (((to.varint == varintSigned || to.varint == varintZigzag) && n < 0) || v.OverflowUint(u)) && !to.wrap {
+		c.error(&OverflowError{Field: c.fieldName(), Width: v.Type().Bits(), Value: n})
+	}
+	v.SetUint(u)
+	return true
+}
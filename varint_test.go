@@ -0,0 +1,160 @@
+package bytecodec
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+type varintTag struct {
+	Uvarint    uint32 `bytecodec:"uvarint"`
+	Varint     int64  `bytecodec:"varint"`
+	VarintPos  int16  `bytecodec:"varint"`
+	Zigzag     int32  `bytecodec:"zigzag"`
+	MQTT       uint32 `bytecodec:"mqttvarint"`
+	MQTTMax    int    `bytecodec:"mqttvarint"`
+	Slice      []int8 `bytecodec:"zigzag;length:2"`
+	DataLength uint16 `bytecodec:"lengthref:Data;uvarint"`
+	Data       []byte
+}
+
+var varintData = bytes.Repeat([]byte{0x1}, 200)
+
+var varintTests = []testcase{{
+	append([]byte{
+		0xac, 0x2,
+		0xc0, 0xbb, 0x78,
+		0xc0, 0x0,
+		0x7f,
+		0xc1, 0x2,
+		0xff, 0xff, 0xff, 0x7f,
+		0x1, 0x2,
+		0xc8, 0x1,
+	}, varintData...),
+	&varintTag{},
+	&varintTag{
+		Uvarint:    300,
+		Varint:     -123456,
+		VarintPos:  64,
+		Zigzag:     -64,
+		MQTT:       321,
+		MQTTMax:    268435455,
+		Slice:      []int8{-1, 1},
+		DataLength: 200,
+		Data:       varintData,
+	},
+}}
+
+func TestVarint(t *testing.T) {
+	testMarshalUnmarshal(t, varintTests)
+}
+
+type varintOverflow struct {
+	Uvarint uint8 `bytecodec:"uvarint"`
+}
+
+type mqttOverflow struct {
+	MQTT uint32 `bytecodec:"mqttvarint"`
+}
+
+type negativeUvarint struct {
+	Uvarint int32 `bytecodec:"uvarint"`
+}
+
+func TestVarintErr(t *testing.T) {
+	if _, err := Marshal(&mqttOverflow{MQTT: maxMQTTVarint + 1}); err == nil {
+		t.Errorf("Marshal mqtt varint overflow, expected error")
+	}
+	if _, err := Marshal(&negativeUvarint{Uvarint: -1}); err == nil {
+		t.Errorf("Marshal negative uvarint, expected error")
+	}
+
+	tests := []struct {
+		b   []byte
+		out interface{}
+	}{
+		{[]byte{0xac, 0x2}, &varintOverflow{}},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x1}, &mqttOverflow{}},
+		{[]byte{0x80}, &varintOverflow{}},
+	}
+	for _, tt := range tests {
+		if err := Unmarshal(tt.b, tt.out); err == nil {
+			t.Errorf("Unmarshal %#v, expected error", tt.b)
+		}
+	}
+
+	// 超过 64 位的变长编码
+	var ve *VarintErr
+	long := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x2}
+	for _, b := range [][]byte{long, append(long[:9:9], 0x81, 0x1)} {
+		if err := Unmarshal(b, &struct {
+			U uint64 `bytecodec:"uvarint"`
+		}{}); !errors.As(err, &ve) {
+			t.Errorf("Unmarshal uvarint %#v got error %v, want VarintErr", b, err)
+		}
+		if err := Unmarshal(b, &struct {
+			N int64 `bytecodec:"varint"`
+		}{}); !errors.As(err, &ve) {
+			t.Errorf("Unmarshal varint %#v got error %v, want VarintErr", b, err)
+		}
+	}
+	max := struct {
+		U uint64 `bytecodec:"uvarint"`
+		N int64  `bytecodec:"varint"`
+		Z int64  `bytecodec:"zigzag"`
+	}{math.MaxUint64, math.MinInt64, math.MinInt64}
+	b, err := Marshal(max)
+	if err != nil || len(b) != 30 {
+		t.Fatalf("Marshal = %#v, %v, want 30 bytes", b, err)
+	}
+	out := max
+	out.U, out.N, out.Z = 0, 0, 0
+	if err := Unmarshal(b, &out); err != nil || out != max {
+		t.Errorf("Unmarshal = %+v, %v, want %+v", out, err, max)
+	}
+
+	var oe *OverflowError
+	if err := Unmarshal([]byte{0xac, 0x2}, &varintOverflow{}); !errors.As(err, &oe) || oe.Field != "Uvarint" || oe.Width != 8 || oe.Value != int64(300) {
+		t.Errorf("Unmarshal uvarint 300 into uint8 got error %v, want OverflowError", err)
+	}
+	// zigzag 编码的 -200，报告解码后的有符号值
+	if err := Unmarshal([]byte{0x8f, 0x3}, &struct {
+		Zigzag int8 `bytecodec:"zigzag"`
+	}{}); !errors.As(err, &oe) || oe.Value != int64(-200) {
+		t.Errorf("Unmarshal zigzag -200 into int8 got error %v, want OverflowError with value -200", err)
+	}
+	if _, err := Marshal(&mqttOverflow{MQTT: maxMQTTVarint + 1}); !errors.As(err, &oe) || oe.Width != 28 {
+		t.Errorf("Marshal mqtt varint overflow got error %v, want OverflowError", err)
+	}
+}
+
+type varintWrap struct {
+	Uvarint uint8  `bytecodec:"uvarint;wrap"`
+	MQTT    uint32 `bytecodec:"mqttvarint;wrap"`
+}
+
+func TestVarintWrap(t *testing.T) {
+	var v varintWrap
+	if err := Unmarshal([]byte{0xac, 0x2, 0x1}, &v); err != nil || v.Uvarint != 44 {
+		t.Errorf("Unmarshal = %#v, %v, want Uvarint 44", v, err)
+	}
+	b, err := Marshal(varintWrap{1, maxMQTTVarint + 2})
+	if want := []byte{0x1, 0x1}; err != nil || !bytes.Equal(b, want) {
+		t.Errorf("Marshal = %#v, %v, want %#v", b, err, want)
+	}
+}
+
+func TestVarintConflict(t *testing.T) {
+	var te *TagErr
+	if _, err := Marshal(struct {
+		A uint32 `bytecodec:"uvarint;mqttvarint"`
+	}{1}); !errors.As(err, &te) {
+		t.Errorf("Marshal got error %v, want TagErr", err)
+	}
+	if err := Unmarshal([]byte{0x1}, &struct {
+		A int32 `bytecodec:"varint;zigzag"`
+	}{}); !errors.As(err, &te) {
+		t.Errorf("Unmarshal got error %v, want TagErr", err)
+	}
+}